@@ -0,0 +1,71 @@
+package main
+
+// Blocks are crates and boulders the player can push. Walking into a block
+// slides it one cell the same way, if there is room for it there; the
+// player follows it into the cell it left. Blocks fall like creatures do,
+// can be stood on, and can be stacked to climb up to somewhere out of
+// reach. They are entities of the room, so they stay where they were pushed
+// when the player leaves the room and when the game is saved.
+
+// isSolidEntity reports whether an entity takes up its cell, so that nothing
+// else can move into it and things can stand on it.
+func isSolidEntity(entity *GameEntity) bool {
+	switch entity.Type {
+	case EntityEnemy, EntityNPC, EntityBlock, EntityPlatform:
+		return entity.Active
+	}
+	return false
+}
+
+// blockAt returns the block in the cell at pos, or nil if there is none.
+func (w *World3D) blockAt(pos Point3D) *GameEntity {
+	cell := cellOf(pos)
+	for i := range w.Entities {
+		entity := &w.Entities[i]
+		if entity.Active && entity.Type == EntityBlock && cellOf(entity.Position) == cell {
+			return entity
+		}
+	}
+	return nil
+}
+
+// occupied reports whether a solid entity or one of the party is in the
+// cell.
+func (fg *FilmationGame) occupied(cell [3]int) bool {
+	for i := range fg.World.Entities {
+		if entity := &fg.World.Entities[i]; isSolidEntity(entity) && cellOf(entity.Position) == cell {
+			return true
+		}
+	}
+	for _, entity := range fg.Party() {
+		if cellOf(entity.Position) == cell {
+			return true
+		}
+	}
+	return false
+}
+
+// PushBlock slides a block one cell along X or Z. A block will not move
+// while it is already sliding or falling, while something stands on it, or
+// if its new cell is not free.
+func (fg *FilmationGame) PushBlock(block *GameEntity, dx, dz float32) bool {
+	if (dx == 0) == (dz == 0) || block.IsMoving || !fg.OnGround(block) {
+		return false
+	}
+
+	cell := cellOf(block.Position)
+	if fg.occupied([3]int{cell[0], cell[1] + 1, cell[2]}) {
+		return false
+	}
+
+	to := block.Position
+	to.X += dx
+	to.Z += dz
+	if fg.IsPositionSolid(to) || fg.occupied(cellOf(to)) {
+		return false
+	}
+
+	block.TargetPosition = to
+	block.IsMoving = true
+	return true
+}
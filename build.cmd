@@ -45,8 +45,8 @@ if %errorlevel% equ 0 (
 )
 
 REM Build the binary
-echo Running: go build -ldflags="-s -w" -o "%TARGETBIN%" game.go assets.go types.go render.go world.go rooms.go
-go build -ldflags="-s -w" -o "%TARGETBIN%" game.go assets.go types.go render.go world.go rooms.go
+echo Running: go build -ldflags="-s -w" -o "%TARGETBIN%" .
+go build -ldflags="-s -w" -o "%TARGETBIN%" .
 
 REM Check build result
 if %errorlevel% equ 0 (
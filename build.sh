@@ -21,7 +21,7 @@ mkdir -p $BUILDDIR
 
 echo "Building for $(uname -s) $(uname -m)..."
 
-go build -ldflags="-s -w" -o $TARGETBIN game.go assets.go types.go render.go world.go rooms.go
+go build -ldflags="-s -w" -o $TARGETBIN .
 
 if [ $? -eq 0 ]; then
     echo "✅ Build successful!"
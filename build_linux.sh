@@ -22,7 +22,7 @@ docker run --rm --platform linux/amd64 -v $(pwd):/app -w /app golang:1.24 \
       libwayland-dev \
       libxkbcommon-dev \
       wayland-protocols && \
-    CGO_ENABLED=1 GOOS=linux GOARCH=amd64 go build -ldflags=\"-s -w\" -o $TARGETBIN game.go assets.go types.go render.go world.go rooms.go
+    CGO_ENABLED=1 GOOS=linux GOARCH=amd64 go build -ldflags=\"-s -w\" -o $TARGETBIN .
   "
 
 if [ $? -eq 0 ]; then
@@ -28,7 +28,7 @@ mkdir -p "$BUILDDIR"
 
 # Build the Go binary
 echo "Building Go binary..."
-go build -ldflags="-s -w" -o "$BUILDDIR/retromansion_macos" game.go assets.go types.go render.go world.go rooms.go
+go build -ldflags="-s -w" -o "$BUILDDIR/retromansion_macos" .
 
 if [ ! -f "$BUILDDIR/retromansion_macos" ]; then
     echo "❌ Failed to build binary"
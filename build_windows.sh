@@ -13,9 +13,9 @@ export GOARCH=amd64
 export CC=x86_64-w64-mingw32-gcc
 export CXX=x86_64-w64-mingw32-g++
 
-# go build -o $BUILDDIR/debug_$BINARY.exe game.go assets.go types.go render.go world.go rooms.go
+# go build -o $BUILDDIR/debug_$BINARY.exe .
 
-go build -ldflags="-s -w" -o $TARGETBIN game.go assets.go types.go render.go world.go rooms.go
+go build -ldflags="-s -w" -o $TARGETBIN .
 
 ls -al $TARGETBIN
 file $TARGETBIN
@@ -23,7 +23,7 @@ docker run --rm --platform linux/amd64 -v $(pwd):/app -w /app golang:1.24 \
     export GOARCH=amd64 && \
     export CC=x86_64-w64-mingw32-gcc && \
     export CXX=x86_64-w64-mingw32-g++ && \
-    go build -ldflags=\"-s -w\" -o $TARGETBIN game.go assets.go types.go render.go world.go rooms.go
+    go build -ldflags=\"-s -w\" -o $TARGETBIN .
   "
 
 if [ $? -eq 0 ]; then
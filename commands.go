@@ -0,0 +1,142 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// The game binary also has a few commands for working on levels without
+// opening a window. They are run as "retromansion <command> [args]".
+var commands = map[string]func(args []string) int{
+	"validate": validateCommand,
+	"dot":      dotCommand,
+}
+
+// mansionSource is a mansion named on a command line: either a level to load
+// or a seed to generate one from.
+type mansionSource struct {
+	name string
+	load func(fg *FilmationGame) error
+}
+
+// mansionSources reads the -seed flag and the level paths left after the
+// flags, in that order.
+func mansionSources(flags *flag.FlagSet, seed *int64) []mansionSource {
+	var sources []mansionSource
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			sources = append(sources, mansionSource{fmt.Sprintf("seed %d", *seed), func(fg *FilmationGame) error {
+				return fg.GenerateMansion(DefaultMansionParams(*seed))
+			}})
+		}
+	})
+	for _, path := range flags.Args() {
+		sources = append(sources, mansionSource{path, func(fg *FilmationGame) error {
+			return fg.LoadLevel(path)
+		}})
+	}
+	return sources
+}
+
+// build loads the mansion. The loaders report their progress on standard
+// output, which is sent to standard error here so that it does not get mixed
+// up with what the command writes.
+func (src mansionSource) build() (*FilmationGame, error) {
+	fg := &FilmationGame{}
+	var err error
+	quietly(func() { err = src.load(fg) })
+	if err != nil {
+		return nil, err
+	}
+	return fg, nil
+}
+
+// quietly runs f with standard output going to standard error.
+func quietly(f func()) {
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	defer func() { os.Stdout = stdout }()
+	f()
+}
+
+// validateCommand loads each level given, or generates a mansion from a
+// seed, and prints every problem found by Level.Validate and CheckRooms. It
+// returns the process exit code.
+func validateCommand(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	seed := flags.Int64("seed", 0, "check a mansion generated from this seed")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: retromansion validate [-seed N] [level ...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	sources := mansionSources(flags, seed)
+	if len(sources) == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	failed := false
+	for _, src := range sources {
+		fg, err := src.build()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s:\n%v\n", src.name, err)
+			failed = true
+			continue
+		}
+		if problems := fg.CheckRooms(); len(problems) > 0 {
+			fmt.Fprintf(os.Stderr, "%s:\n%v\n", src.name, problems)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s: ok\n", src.name)
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// dotCommand writes the room graph of one mansion as Graphviz DOT.
+func dotCommand(args []string) int {
+	flags := flag.NewFlagSet("dot", flag.ExitOnError)
+	seed := flags.Int64("seed", 0, "draw a mansion generated from this seed")
+	out := flags.String("o", "", "write the graph to this file instead of standard output")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: retromansion dot [-o file.dot] (-seed N | level)")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	sources := mansionSources(flags, seed)
+	if len(sources) != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	fg, err := sources[0].build()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s:\n%v\n", sources[0].name, err)
+		return 1
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := fg.Rooms.WriteDOT(w); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// The player's settings are kept in config.json in the user's config
+// directory, $XDG_CONFIG_HOME/retromansion on Linux, and can be changed from
+// the options menu. docs/options.md describes the file.
+
+// Config is what the player can set. Width and Height are the size of the
+// screen the game draws, which the window shows WindowScale times over, and
+// TileScale the width of a floor tile on it.
+type Config struct {
+	MusicVolume   int               `json:"music_volume"`
+	EffectsVolume int               `json:"effects_volume"`
+	WindowScale   int               `json:"window_scale"`
+	Fullscreen    bool              `json:"fullscreen"`
+	Keys          map[string]string `json:"keys"`
+	Difficulty    string            `json:"difficulty"`
+	ShowFPS       bool              `json:"show_fps"`
+
+	Width     int32   `json:"width"`
+	Height    int32   `json:"height"`
+	FPS       int32   `json:"fps"`
+	TileScale float32 `json:"tile_scale"`
+}
+
+const maxWindowScale = 4
+
+// keyActions are the actions that can be bound to a key, in the order the
+// options menu lists them.
+var keyActions = []string{"up", "down", "left", "right", "jump", "use", "attack", "bag", "pause"}
+
+var keyActionLabels = map[string]string{
+	"up": "MOVE UP", "down": "MOVE DOWN", "left": "MOVE LEFT", "right": "MOVE RIGHT",
+	"jump": "JUMP", "use": "USE", "attack": "ATTACK", "bag": "BAG", "pause": "PAUSE",
+}
+
+var defaultKeys = map[string]string{
+	"up": "W", "down": "S", "left": "A", "right": "D",
+	"jump": "J", "use": "E", "attack": "SPACE", "bag": "I", "pause": "P",
+}
+
+// keyCodes are the keys that can be bound, by the names the config file
+// uses. The arrow keys, Escape, Tab, Enter, Backspace, the number keys and
+// the save and load keys keep their own jobs and cannot be bound.
+var keyCodes = func() map[string]int32 {
+	codes := map[string]int32{
+		"SPACE":      rl.KeySpace,
+		"LEFT_SHIFT": rl.KeyLeftShift, "RIGHT_SHIFT": rl.KeyRightShift,
+		"LEFT_CONTROL": rl.KeyLeftControl, "RIGHT_CONTROL": rl.KeyRightControl,
+		"LEFT_ALT": rl.KeyLeftAlt, "RIGHT_ALT": rl.KeyRightAlt,
+		"COMMA": rl.KeyComma, "PERIOD": rl.KeyPeriod, "SLASH": rl.KeySlash,
+		"SEMICOLON": rl.KeySemicolon, "APOSTROPHE": rl.KeyApostrophe,
+	}
+	for c := 'A'; c <= 'Z'; c++ {
+		codes[string(c)] = rl.KeyA + (c - 'A')
+	}
+	return codes
+}()
+
+// difficultyDamage scales the damage the player takes.
+var difficultyDamage = map[string]float32{"easy": 0.5, "normal": 1, "hard": 2}
+
+var difficulties = []string{"easy", "normal", "hard"}
+
+func DefaultConfig() Config {
+	return Config{
+		MusicVolume:   80,
+		EffectsVolume: 80,
+		WindowScale:   1,
+		Keys:          maps.Clone(defaultKeys),
+		Difficulty:    "normal",
+		Width:         800,
+		Height:        600,
+		FPS:           60,
+		TileScale:     54,
+	}
+}
+
+// ConfigPath is where the config file goes when the -config flag does not
+// say, or "" if the system has no config directory.
+func ConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "retromansion", "config.json")
+}
+
+// LoadConfig reads the config file at path. A file that is not there gives
+// the defaults. A value that is out of range or unknown is reported and
+// replaced by its default, so one bad line does not lose the rest.
+func LoadConfig(path string) (Config, error) {
+	config := DefaultConfig()
+	if path == "" {
+		return config, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+
+	config.Keys = nil
+	if err := json.Unmarshal(data, &config); err != nil {
+		return DefaultConfig(), fmt.Errorf("%s: %v", path, err)
+	}
+	if errs := config.check(); len(errs) > 0 {
+		return config, fmt.Errorf("%s:\n%s", path, strings.Join(errs, "\n"))
+	}
+	return config, nil
+}
+
+// check puts back the default of every value that is out of range, and
+// says which they were.
+func (c *Config) check() []string {
+	var errs []string
+	defaults := DefaultConfig()
+	fix := func(bad bool, format string, args ...interface{}) bool {
+		if bad {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+		return bad
+	}
+
+	if fix(c.MusicVolume < 0 || c.MusicVolume > 100, "music_volume: %d is not between 0 and 100", c.MusicVolume) {
+		c.MusicVolume = defaults.MusicVolume
+	}
+	if fix(c.EffectsVolume < 0 || c.EffectsVolume > 100, "effects_volume: %d is not between 0 and 100", c.EffectsVolume) {
+		c.EffectsVolume = defaults.EffectsVolume
+	}
+	if fix(c.WindowScale < 1 || c.WindowScale > maxWindowScale, "window_scale: %d is not between 1 and %d", c.WindowScale, maxWindowScale) {
+		c.WindowScale = defaults.WindowScale
+	}
+	if _, ok := difficultyDamage[c.Difficulty]; fix(!ok, "difficulty: unknown difficulty %q (want one of %s)", c.Difficulty, strings.Join(difficulties, ", ")) {
+		c.Difficulty = defaults.Difficulty
+	}
+	if fix(c.Width <= 0 || c.Height <= 0, "width, height: %dx%d is not a screen size", c.Width, c.Height) {
+		c.Width, c.Height = defaults.Width, defaults.Height
+	}
+	if fix(c.FPS <= 0, "fps: %d is not greater than 0", c.FPS) {
+		c.FPS = defaults.FPS
+	}
+	if fix(c.TileScale <= 0, "tile_scale: %g is not greater than 0", c.TileScale) {
+		c.TileScale = defaults.TileScale
+	}
+
+	keys := make(map[string]string)
+	for _, action := range keyActions {
+		name, ok := c.Keys[action]
+		if _, known := keyCodes[name]; !ok || fix(!known, "keys.%s: unknown key %q", action, name) {
+			name = defaultKeys[action]
+		}
+		keys[action] = name
+	}
+	for action := range c.Keys {
+		fix(!slices.Contains(keyActions, action), "keys.%s: unknown action (want one of %s)", action, strings.Join(keyActions, ", "))
+	}
+	c.Keys = keys
+
+	sort.Strings(errs)
+	return errs
+}
+
+// SaveConfig writes the config to the game's config file, making its
+// directory if needed.
+func (fg *FilmationGame) SaveConfig() {
+	if fg.ConfigPath == "" {
+		return
+	}
+	data, err := json.MarshalIndent(&fg.Config, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(fg.ConfigPath), 0755)
+	}
+	if err == nil {
+		err = writeFileAtomic(fg.ConfigPath, append(data, '\n'), 0644)
+	}
+	if err != nil {
+		fg.ShowMessage(fmt.Sprintf("Could not save the options: %v", err))
+	}
+}
+
+// ApplyConfig makes the window, frame rate and music match the config.
+func (fg *FilmationGame) ApplyConfig() {
+	c := &fg.Config
+	rl.SetTargetFPS(c.FPS)
+	if fg.BackgroundMusic.Stream.SampleRate > 0 {
+		rl.SetMusicVolume(fg.BackgroundMusic, float32(c.MusicVolume)/100)
+	}
+
+	if c.Fullscreen != rl.IsWindowFullscreen() {
+		if c.Fullscreen {
+			monitor := rl.GetCurrentMonitor()
+			rl.SetWindowSize(rl.GetMonitorWidth(monitor), rl.GetMonitorHeight(monitor))
+		}
+		rl.ToggleFullscreen()
+	}
+	if !c.Fullscreen {
+		rl.SetWindowSize(int(c.Width)*c.WindowScale, int(c.Height)*c.WindowScale)
+	}
+}
+
+// key is the key bound to an action.
+func (fg *FilmationGame) key(action string) int32 {
+	if code, ok := keyCodes[fg.Config.Keys[action]]; ok {
+		return code
+	}
+	return keyCodes[defaultKeys[action]]
+}
+
+// keyLabel is the name of the key bound to an action, as the HUD shows it.
+func (fg *FilmationGame) keyLabel(action string) string {
+	if name, ok := fg.Config.Keys[action]; ok {
+		return name
+	}
+	return defaultKeys[action]
+}
+
+// rebind binds the key that was just pressed, if any, to the action the
+// options menu is waiting on. Escape leaves the binding as it was.
+func (fg *FilmationGame) rebind() {
+	pressed := rl.GetKeyPressed()
+	if pressed == 0 {
+		return
+	}
+	action := fg.rebinding
+	fg.rebinding = ""
+	if pressed == rl.KeyEscape {
+		return
+	}
+
+	name := ""
+	for n, code := range keyCodes {
+		if code == pressed {
+			name = n
+		}
+	}
+	if name == "" {
+		fg.ShowMessage("That key cannot be bound.")
+		return
+	}
+	fg.bindKey(action, name)
+	fg.SaveConfig()
+}
+
+// bindKey binds the key called name to action. A key already bound to
+// another action swaps with it, so that no action is left without a key.
+func (fg *FilmationGame) bindKey(action, name string) {
+	keys := make(map[string]string)
+	for _, a := range keyActions {
+		keys[a] = fg.keyLabel(a)
+	}
+	for _, a := range keyActions {
+		if keys[a] == name {
+			keys[a] = keys[action]
+		}
+	}
+	keys[action] = name
+	fg.Config.Keys = keys
+}
+
+// optionsMenu gives the items of the options menu. Left and right change
+// a value, and Enter changes it or starts binding a key.
+func (fg *FilmationGame) optionsMenu() []menuItem {
+	c := &fg.Config
+	changed := func() {
+		fg.ApplyConfig()
+		fg.SaveConfig()
+	}
+	volume := func(label string, v *int) menuItem {
+		adjust := func(step int) {
+			*v = max(0, min(100, *v+10*step))
+			changed()
+		}
+		return menuItem{label: fmt.Sprintf("%s  < %d%% >", label, *v), choose: func() { adjust(1) }, adjust: adjust}
+	}
+	toggle := func(label string, v *bool) menuItem {
+		flip := func(int) {
+			*v = !*v
+			changed()
+		}
+		state := "OFF"
+		if *v {
+			state = "ON"
+		}
+		return menuItem{label: fmt.Sprintf("%s  < %s >", label, state), choose: func() { flip(1) }, adjust: flip}
+	}
+
+	scale := func(step int) {
+		c.WindowScale = max(1, min(maxWindowScale, c.WindowScale+step))
+		changed()
+	}
+	difficulty := func(step int) {
+		i := slices.Index(difficulties, c.Difficulty)
+		c.Difficulty = difficulties[(i+step+len(difficulties))%len(difficulties)]
+		changed()
+	}
+
+	items := []menuItem{
+		volume("MUSIC VOLUME", &c.MusicVolume),
+		volume("EFFECTS VOLUME", &c.EffectsVolume),
+		{label: fmt.Sprintf("WINDOW SCALE  < %dx >", c.WindowScale), choose: func() { scale(1) }, adjust: scale},
+		toggle("FULLSCREEN", &c.Fullscreen),
+		{label: fmt.Sprintf("DIFFICULTY  < %s >", strings.ToUpper(c.Difficulty)), choose: func() { difficulty(1) }, adjust: difficulty},
+		toggle("SHOW FPS", &c.ShowFPS),
+	}
+	for _, action := range keyActions {
+		label := fmt.Sprintf("%s: %s", keyActionLabels[action], fg.keyLabel(action))
+		if fg.rebinding == action {
+			label = fmt.Sprintf("%s: PRESS A KEY", keyActionLabels[action])
+		}
+		items = append(items, menuItem{label: label, choose: func() { fg.rebinding = action }})
+	}
+	return append(items, menuItem{label: "BACK", choose: fg.PopState})
+}
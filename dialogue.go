@@ -0,0 +1,319 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// Dialogues are what NPCs say when the player faces them and presses the
+// use key, E unless it is rebound. A dialogue is a file of nodes, each a run
+// of script commands plus three of its own: say, which adds a line to the
+// text box, choice, which offers the player an answer and the node it leads
+// to, and jump, which goes straight to another node. Talking starts at the
+// node called start:
+//
+//	name "Groundskeeper"
+//
+//	node start
+//	    say "You'll want the cellar key, I expect."
+//	    if lacks key:cellar
+//	        choice "Yes, please." give_key
+//	    end
+//	    choice "Goodbye."
+//	end
+//
+//	node give_key
+//	    give key:cellar
+//	    set met_keeper 1
+//	    say "Mind the rats."
+//	end
+//
+// A choice without a node ends the conversation. A node that offers no
+// choices gets a Continue that does. docs/dialogue.md describes the format.
+
+// maxDialogueJumps stops a dialogue whose nodes jump to each other forever.
+const maxDialogueJumps = 100
+
+var npcTint = rl.Color{R: 150, G: 220, B: 170, A: 255}
+
+type DialogueChoice struct {
+	Text string
+	Node string
+}
+
+// DialogueBox is the conversation on screen: the lines the NPC has said at
+// the current node and the choices the player has there.
+type DialogueBox struct {
+	Open     bool
+	File     string
+	Speaker  string
+	Lines    []string
+	Choices  []DialogueChoice
+	Selected int
+
+	jump string
+}
+
+// ParseDialogue reads a dialogue, reporting every problem with its line.
+func ParseDialogue(file string, r io.Reader) (*Script, error) {
+	var errs LevelErrors
+	addf := func(line int, format string, args ...interface{}) {
+		errs = append(errs, LevelError{File: file, Line: line, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	lines, err := readScriptLines(r, addf)
+	if err != nil {
+		return nil, err
+	}
+
+	script := &Script{File: file, Nodes: make(map[string][]ScriptCommand)}
+	nodeLines := make(map[string]int)
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case line.fields[0] == "name" && len(line.fields) == 2:
+			speaker, err := strconv.Unquote(line.fields[1])
+			if err != nil || !strings.HasPrefix(line.fields[1], "\"") {
+				addf(line.no, "name expects a quoted string, not %s", line.fields[1])
+			}
+			script.Speaker = speaker
+			i++
+			continue
+
+		case line.fields[0] != "node" || len(line.fields) != 2:
+			addf(line.no, "expected \"name <text>\" or \"node <name>\"")
+			i++
+			continue
+		}
+
+		name := line.fields[1]
+		if !isScriptName(name) {
+			addf(line.no, "%q is not a node name", name)
+		}
+		body, next, end := parseScriptBlock(lines, i+1, true, addf)
+		switch end {
+		case "":
+			addf(line.no, "\"node %s\" has no \"end\"", name)
+		case "else":
+			addf(lines[next-1].no, "\"else\" without \"if\"")
+		}
+		if first, ok := nodeLines[name]; ok {
+			addf(line.no, "node %s is already defined on line %d", name, first)
+		} else {
+			nodeLines[name] = line.no
+			script.Nodes[name] = body
+		}
+		i = next
+	}
+
+	if _, ok := script.Nodes["start"]; !ok {
+		addf(0, "there is no start node")
+	}
+	for _, body := range script.Nodes {
+		walkScript(body, func(cmd ScriptCommand) {
+			var target string
+			switch {
+			case cmd.Name == "jump" && len(cmd.Args) == 1:
+				target = cmd.Args[0]
+			case cmd.Name == "choice" && len(cmd.Args) == 2:
+				target = cmd.Args[1]
+			}
+			if _, ok := script.Nodes[target]; target != "" && !ok {
+				addf(cmd.Line, "unknown node %s", target)
+			}
+		})
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return script, nil
+}
+
+// npcInFront returns the NPC with a dialogue in the cell the player faces,
+// or nil if there is none.
+func (fg *FilmationGame) npcInFront() *GameEntity {
+	cell := cellOf(inFront(fg.Player))
+	for i := range fg.World.Entities {
+		npc := &fg.World.Entities[i]
+		if npc.Active && npc.Type == EntityNPC && npc.Dialogue != "" && cellOf(npc.Position) == cell {
+			return npc
+		}
+	}
+	return nil
+}
+
+// Talk turns npc to face the player and starts its dialogue.
+func (fg *FilmationGame) Talk(npc *GameEntity) {
+	script := fg.Scripts[npc.Dialogue]
+	if script == nil {
+		fg.ShowMessage("They have nothing to say.")
+		return
+	}
+
+	dx := fg.Player.Position.X - npc.Position.X
+	dz := fg.Player.Position.Z - npc.Position.Z
+	switch {
+	case abs(dx) >= abs(dz) && dx < 0:
+		npc.Direction = DirLeft
+	case abs(dx) >= abs(dz):
+		npc.Direction = DirRight
+	case dz < 0:
+		npc.Direction = DirUp
+	default:
+		npc.Direction = DirDown
+	}
+
+	fg.Dialogue = DialogueBox{Open: true, File: npc.Dialogue, Speaker: script.Speaker}
+	fg.enterNode("start")
+}
+
+// enterNode runs a node of the open dialogue, following its jumps, and
+// shows what it says. A node that says nothing and offers no choices ends
+// the conversation.
+func (fg *FilmationGame) enterNode(name string) {
+	d := &fg.Dialogue
+	script := fg.Scripts[d.File]
+	d.Lines, d.Choices, d.Selected = nil, nil, 0
+
+	for range maxDialogueJumps {
+		body, ok := script.Nodes[name]
+		if !ok {
+			fmt.Printf("%s: unknown node %s\n", d.File, name)
+			break
+		}
+		fg.runScript(d.File, body)
+		if d.jump == "" {
+			break
+		}
+		name, d.jump = d.jump, ""
+	}
+	d.jump = ""
+
+	if len(d.Lines) == 0 && len(d.Choices) == 0 {
+		fg.closeDialogue()
+	}
+}
+
+// Choose takes the player's answer i, or moves on from a node without
+// choices.
+func (fg *FilmationGame) Choose(i int) {
+	d := &fg.Dialogue
+	if len(d.Choices) == 0 {
+		fg.closeDialogue()
+		return
+	}
+	if i < 0 || i >= len(d.Choices) {
+		return
+	}
+	if node := d.Choices[i].Node; node != "" {
+		fg.enterNode(node)
+	} else {
+		fg.closeDialogue()
+	}
+}
+
+func (fg *FilmationGame) closeDialogue() {
+	fg.Dialogue = DialogueBox{}
+	fg.InputDelay = 0.2
+	fg.finishScripts()
+}
+
+// HandleDialogueInput moves through the choices and takes the chosen one.
+// The number keys choose directly, and backspace walks away.
+func (fg *FilmationGame) HandleDialogueInput() {
+	d := &fg.Dialogue
+
+	switch {
+	case rl.IsKeyPressed(rl.KeyBackspace):
+		fg.closeDialogue()
+
+	case rl.IsKeyPressed(rl.KeyUp) || rl.IsKeyPressed(fg.key("up")):
+		if d.Selected > 0 {
+			d.Selected--
+		}
+
+	case rl.IsKeyPressed(rl.KeyDown) || rl.IsKeyPressed(fg.key("down")):
+		if d.Selected+1 < len(d.Choices) {
+			d.Selected++
+		}
+
+	case rl.IsKeyPressed(rl.KeyEnter) || rl.IsKeyPressed(rl.KeySpace) || rl.IsKeyPressed(fg.key("use")):
+		fg.Choose(d.Selected)
+
+	default:
+		for i := range min(len(d.Choices), 9) {
+			if rl.IsKeyPressed(int32(rl.KeyOne) + int32(i)) {
+				fg.Choose(i)
+				return
+			}
+		}
+	}
+}
+
+// RenderDialogue draws the text box along the bottom of the screen, with
+// the speaker's name, what they said, and the player's choices.
+func (fg *FilmationGame) RenderDialogue() {
+	d := &fg.Dialogue
+	width := fg.ScreenW - 40
+	textWidth := width - 30
+
+	var lines []string
+	for _, line := range d.Lines {
+		lines = append(lines, wrapText(line, 10, textWidth)...)
+	}
+	choices := d.Choices
+	if len(choices) == 0 {
+		choices = []DialogueChoice{{Text: "Continue"}}
+	}
+
+	height := int32(56 + 14*len(lines) + 18*len(choices))
+	x, y := int32(20), fg.ScreenH-height-20
+	rl.DrawRectangle(x, y, width, height, rl.Color{R: 30, G: 35, B: 50, A: 240})
+	rl.DrawRectangleLines(x, y, width, height, rl.LightGray)
+
+	rowY := y + 10
+	if d.Speaker != "" {
+		rl.DrawText(d.Speaker, x+15, rowY, 10, rl.Gold)
+	}
+	rowY += 16
+	for _, line := range lines {
+		rl.DrawText(line, x+15, rowY, 10, rl.White)
+		rowY += 14
+	}
+
+	rowY += 6
+	for i, choice := range choices {
+		color := rl.LightGray
+		if i == d.Selected {
+			rl.DrawRectangle(x+8, rowY-4, width-16, 17, rl.Color{R: 70, G: 80, B: 110, A: 255})
+			color = rl.White
+		}
+		rl.DrawText(fmt.Sprintf("%d. %s", i+1, choice.Text), x+15, rowY, 10, color)
+		rowY += 18
+	}
+
+	rl.DrawText("UP/DOWN: CHOOSE | ENTER: ANSWER | BACKSPACE: LEAVE", x+15, y+height-16, 10, rl.Gray)
+}
+
+// wrapText breaks text into lines no wider than width at the given font
+// size.
+func wrapText(text string, fontSize, width int32) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && rl.MeasureText(line+" "+word, fontSize) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	return append(lines, line)
+}
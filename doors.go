@@ -0,0 +1,157 @@
+package main
+
+import (
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// Doors open and close. A door tile is closed while it is solid, so whether
+// each door is open is kept with the room's tiles, and is saved with them.
+// Doors start open unless the level makes them solid, and a locked door
+// starts closed. The player opens and closes the door in front of them with
+// the interact key; a locked door opens once the player has its key.
+//
+// A door that is opening or closing fades from one sprite to the other.
+// Only the drawing is animated: the door stops or lets things through as
+// soon as it is closed or opened.
+
+// doorSwingTime is how long a door takes to open or close, in seconds.
+const doorSwingTime = 0.3
+
+func (w *World3D) isDoor(x, y, z int) bool {
+	return x >= 0 && x < w.Width && y >= 0 && y < w.Height && z >= 0 && z < w.Depth &&
+		w.Tiles[x][y][z].Type == TileDoor
+}
+
+// inFront is the cell next to an entity in the direction it faces.
+func inFront(entity *GameEntity) Point3D {
+	cell := cellOf(entity.Position)
+	pos := Point3D{X: float32(cell[0]), Y: float32(cell[1]), Z: float32(cell[2])}
+	switch entity.Direction {
+	case DirLeft:
+		pos.X -= 1.0
+	case DirRight:
+		pos.X += 1.0
+	case DirUp:
+		pos.Z -= 1.0
+	case DirDown:
+		pos.Z += 1.0
+	}
+	return pos
+}
+
+// connectionAt returns the current room's connection at a cell, or nil if
+// there is none.
+func (fg *FilmationGame) connectionAt(pos Point3D) *RoomConnection {
+	room := fg.Rooms.Rooms[fg.Rooms.CurrentRoom]
+	if room == nil {
+		return nil
+	}
+	for i := range room.Connections {
+		if conn := &room.Connections[i]; conn.Active && conn.Position == pos {
+			return conn
+		}
+	}
+	return nil
+}
+
+// ToggleDoor opens the door at pos if it is closed, unlocking it if it needs
+// a key, or closes it if it is open. A door will not close on anything
+// standing in the doorway. It reports whether the door moved.
+func (fg *FilmationGame) ToggleDoor(pos Point3D) bool {
+	x, y, z := int(pos.X), int(pos.Y), int(pos.Z)
+	if !fg.World.isDoor(x, y, z) {
+		return false
+	}
+	tile := &fg.World.Tiles[x][y][z]
+
+	if tile.Solid {
+		if conn := fg.connectionAt(pos); conn != nil && !fg.Unlock(conn) {
+			return false
+		}
+		return fg.setDoor(pos, true)
+	}
+	if !fg.setDoor(pos, false) {
+		fg.ShowMessage("Something is in the way.")
+		return false
+	}
+	return true
+}
+
+// setDoor opens or closes the door at pos, whether or not it is locked,
+// unless closing it would shut it on something in the doorway. It reports
+// whether the door is now as asked.
+func (fg *FilmationGame) setDoor(pos Point3D, open bool) bool {
+	x, y, z := int(pos.X), int(pos.Y), int(pos.Z)
+	if !fg.World.isDoor(x, y, z) {
+		return false
+	}
+	tile := &fg.World.Tiles[x][y][z]
+	if tile.Solid != open {
+		return true
+	}
+	if !open && fg.inDoorway(pos) {
+		return false
+	}
+
+	if fg.doorSwing == nil {
+		fg.doorSwing = make(map[Point3D]float32)
+	}
+	fg.doorSwing[pos] = fg.doorOpenness(tile)
+	tile.Solid = !open
+	return true
+}
+
+func (fg *FilmationGame) inDoorway(pos Point3D) bool {
+	cell := cellOf(pos)
+	for i := range fg.World.Entities {
+		if entity := &fg.World.Entities[i]; entity.Active && cellOf(entity.Position) == cell {
+			return true
+		}
+	}
+	for _, entity := range fg.Party() {
+		if cellOf(entity.Position) == cell || cellOf(entity.TargetPosition) == cell {
+			return true
+		}
+	}
+	return false
+}
+
+// doorOpenness is how far open a door is drawn, from 0 for closed to 1 for
+// open.
+func (fg *FilmationGame) doorOpenness(tile *Tile3D) float32 {
+	if swing, ok := fg.doorSwing[tile.Position]; ok {
+		return swing
+	}
+	if tile.Solid {
+		return 0
+	}
+	return 1
+}
+
+// UpdateDoors moves the doors that are opening or closing on by one frame.
+func (fg *FilmationGame) UpdateDoors(deltaTime float32) {
+	for pos, swing := range fg.doorSwing {
+		x, y, z := int(pos.X), int(pos.Y), int(pos.Z)
+		if !fg.World.isDoor(x, y, z) {
+			delete(fg.doorSwing, pos)
+			continue
+		}
+
+		step := deltaTime / doorSwingTime
+		if fg.World.Tiles[x][y][z].Solid {
+			swing -= step
+		} else {
+			swing += step
+		}
+		if swing <= 0 || swing >= 1 {
+			delete(fg.doorSwing, pos)
+		} else {
+			fg.doorSwing[pos] = swing
+		}
+	}
+}
+
+// doorTint draws a door sprite faded by alpha, from 0 to 1.
+func doorTint(alpha float32) rl.Color {
+	return rl.Color{R: 255, G: 255, B: 255, A: uint8(255 * alpha)}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// WriteDOT writes the rooms and their connections as a Graphviz digraph.
+// Rooms are nodes labelled with their name and size, and the room the player
+// is in is drawn with a double border. Each connection is an edge labelled
+// with the door's position, where it leads and the direction the player
+// faces on arrival. Locked doors are red and inactive ones dotted. In a
+// mansion with more than one floor, rooms on the same floor are drawn side by
+// side.
+//
+// Render it with, for example, "dot -Tsvg mansion.dot -o mansion.svg".
+func (rm *RoomManager) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	ids := make([]int, 0, len(rm.Rooms))
+	for id := range rm.Rooms {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	fmt.Fprintln(bw, "digraph mansion {")
+	fmt.Fprintln(bw, "  node [shape=box];")
+
+	storeys := make(map[int][]int)
+	for _, id := range ids {
+		storeys[rm.Rooms[id].Storey] = append(storeys[rm.Rooms[id].Storey], id)
+	}
+
+	for _, id := range ids {
+		room := rm.Rooms[id]
+		label := fmt.Sprintf("%d: %s\\n%dx%dx%d", id, dotEscape(room.Name), room.World.Width, room.World.Height, room.World.Depth)
+		if len(storeys) > 1 {
+			label += fmt.Sprintf(", floor %d", room.Storey)
+		}
+		attrs := ""
+		if id == rm.CurrentRoom {
+			attrs = ", peripheries=2"
+		}
+		fmt.Fprintf(bw, "  %d [label=\"%s\"%s];\n", id, label, attrs)
+	}
+
+	if len(storeys) > 1 {
+		floors := make([]int, 0, len(storeys))
+		for storey := range storeys {
+			floors = append(floors, storey)
+		}
+		sort.Ints(floors)
+		for _, storey := range floors {
+			fmt.Fprint(bw, "  { rank=same;")
+			for _, id := range storeys[storey] {
+				fmt.Fprintf(bw, " %d;", id)
+			}
+			fmt.Fprintln(bw, " }")
+		}
+	}
+
+	missing := make(map[int]bool)
+	for _, id := range ids {
+		for _, conn := range rm.Rooms[id].Connections {
+			if rm.Rooms[conn.ToRoomID] == nil && !missing[conn.ToRoomID] {
+				missing[conn.ToRoomID] = true
+				fmt.Fprintf(bw, "  %d [label=\"room %d\\n(missing)\", style=dashed];\n", conn.ToRoomID, conn.ToRoomID)
+			}
+		}
+	}
+
+	for _, id := range ids {
+		for _, conn := range rm.Rooms[id].Connections {
+			label := []string{
+				fmt.Sprintf("%s -> %s", formatPoint(conn.Position), formatPoint(conn.ToPosition)),
+				directionNames[conn.Direction],
+			}
+			var attrs []string
+			if conn.RequiresKey {
+				label[1] += ", locked"
+				if conn.Key != "" {
+					label[1] += " (" + dotEscape(conn.Key) + ")"
+				}
+				attrs = append(attrs, "color=red", "fontcolor=red")
+			}
+			if !conn.Active {
+				label[1] += ", inactive"
+				attrs = append(attrs, "style=dotted")
+			}
+			attrs = append([]string{fmt.Sprintf("label=\"%s\"", strings.Join(label, "\\n"))}, attrs...)
+			fmt.Fprintf(bw, "  %d -> %d [%s];\n", id, conn.ToRoomID, strings.Join(attrs, ", "))
+		}
+	}
+
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+func dotEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"os"
 
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
@@ -12,6 +14,12 @@ func (fg *FilmationGame) HandleInput() {
 		return
 	}
 
+	// Jumping does not wait for a step to finish, so the player can jump
+	// across a gap.
+	if rl.IsKeyPressed(fg.key("jump")) {
+		fg.Jump(fg.Player)
+	}
+
 	if fg.Player.IsMoving && !PointsNearlyEqual(fg.Player.Position, fg.Player.TargetPosition, 0.1) {
 		return
 	}
@@ -25,38 +33,73 @@ func (fg *FilmationGame) HandleInput() {
 		fg.UpdatePlayerBounds()
 	}
 
-	if rl.IsKeyPressed(rl.KeyLeft) || rl.IsKeyPressed(rl.KeyA) {
+	if rl.IsKeyPressed(rl.KeyLeft) || rl.IsKeyPressed(fg.key("left")) {
 		newTargetPos.X -= 1.0
 		fg.Player.Direction = DirLeft
 		moved = true
-	} else if rl.IsKeyPressed(rl.KeyRight) || rl.IsKeyPressed(rl.KeyD) {
+	} else if rl.IsKeyPressed(rl.KeyRight) || rl.IsKeyPressed(fg.key("right")) {
 		newTargetPos.X += 1.0
 		fg.Player.Direction = DirRight
 		moved = true
 	}
 
-	if rl.IsKeyPressed(rl.KeyUp) || rl.IsKeyPressed(rl.KeyW) {
+	if rl.IsKeyPressed(rl.KeyUp) || rl.IsKeyPressed(fg.key("up")) {
 		newTargetPos.Z -= 1.0
 		fg.Player.Direction = DirUp
 		moved = true
-	} else if rl.IsKeyPressed(rl.KeyDown) || rl.IsKeyPressed(rl.KeyS) {
+	} else if rl.IsKeyPressed(rl.KeyDown) || rl.IsKeyPressed(fg.key("down")) {
 		newTargetPos.Z += 1.0
 		fg.Player.Direction = DirDown
 		moved = true
 	}
 
-	if rl.IsKeyPressed(rl.KeySpace) {
+	if rl.IsKeyPressed(fg.key("attack")) {
 		fg.PlayerAttack()
 		fg.InputDelay = 0.2
 		return
 	}
 
+	if rl.IsKeyPressed(fg.key("use")) {
+		fg.Interact()
+		fg.InputDelay = 0.2
+		return
+	}
+
+	if rl.IsKeyPressed(rl.KeyF5) || rl.IsKeyPressed(rl.KeyF9) {
+		fg.OpenSlotPicker(rl.IsKeyPressed(rl.KeyF5))
+		return
+	}
+
+	for i := 0; i < fg.Inventory.hotkeys(); i++ {
+		if rl.IsKeyPressed(rl.KeyOne + int32(i)) {
+			fg.UseItem(i)
+			fg.InputDelay = 0.2
+			return
+		}
+	}
+
 	if moved {
 		fg.InputDelay = 0.05
 
-		if !fg.IsPositionSolid(newTargetPos) {
+		// Steps end on the grid, even when taken from a moving platform.
+		cell := cellOf(newTargetPos)
+		newTargetPos.X, newTargetPos.Z = float32(cell[0]), float32(cell[2])
+
+		// Walking into a block pushes it, and the player follows it.
+		pushed := false
+		if block := fg.World.blockAt(newTargetPos); block != nil {
+			pushed = fg.PushBlock(block, newTargetPos.X-fg.Player.Position.X, newTargetPos.Z-fg.Player.Position.Z)
+		}
+		if pushed || !fg.IsPositionSolid(newTargetPos) {
 			fg.Player.TargetPosition = newTargetPos
 			fg.Player.IsMoving = true
+		} else if cell := cellOf(newTargetPos); fg.World.isDoor(cell[0], cell[1], cell[2]) {
+			door := Point3D{X: float32(cell[0]), Y: float32(cell[1]), Z: float32(cell[2])}
+			if fg.IsDoorLocked(door) {
+				fg.ShowMessage(fmt.Sprintf("The door is locked. Press %s to unlock it.", fg.keyLabel("use")))
+			} else {
+				fg.ShowMessage(fmt.Sprintf("The door is closed. Press %s to open it.", fg.keyLabel("use")))
+			}
 		}
 	}
 }
@@ -69,64 +112,111 @@ func (fg *FilmationGame) UpdatePlayerBounds() {
 	}
 }
 
+// NewPlayer makes the player entity, standing at pos and facing down.
+func NewPlayer(pos Point3D) *GameEntity {
+	return &GameEntity{
+		ID:        999,
+		Type:      EntityPlayer,
+		Position:  pos,
+		Direction: DirDown,
+		Bounds: BoundingBox3D{
+			Min: Point3D{X: pos.X - 0.4, Y: pos.Y - 0.4, Z: pos.Z - 0.4},
+			Max: Point3D{X: pos.X + 0.4, Y: pos.Y + 0.4, Z: pos.Z + 0.4},
+		},
+		Active:    true,
+		Color:     rl.White,
+		Health:    10,
+		MaxHealth: 10,
+
+		TargetPosition: pos,
+		IsMoving:       false,
+		MoveSpeed:      4.0,
+		MoveTimer:      0.0,
+	}
+}
+
+// Party returns the player followed by their companions.
+func (fg *FilmationGame) Party() []*GameEntity {
+	if fg.Player == nil {
+		return nil
+	}
+	return append([]*GameEntity{fg.Player}, fg.Companions...)
+}
+
 func (fg *FilmationGame) UpdateMovement() {
 	deltaTime := rl.GetFrameTime()
 
+	fg.UpdatePlatforms(deltaTime)
 	for i := range fg.World.Entities {
-		entity := &fg.World.Entities[i]
-		if !entity.Active || !entity.IsMoving {
-			continue
-		}
+		fg.moveEntity(&fg.World.Entities[i], deltaTime)
+	}
+	for _, entity := range fg.Party() {
+		fg.moveEntity(entity, deltaTime)
+	}
 
-		moveSpeed := entity.MoveSpeed
-		if moveSpeed <= 0 {
-			moveSpeed = 4.0
+	for i := range fg.World.Entities {
+		if entity := &fg.World.Entities[i]; fallsWithGravity(entity) {
+			fg.applyGravity(entity, deltaTime)
 		}
+	}
+	for _, entity := range fg.Party() {
+		fg.applyGravity(entity, deltaTime)
+	}
+}
 
-		moveDistance := moveSpeed * deltaTime
+func (fg *FilmationGame) moveEntity(entity *GameEntity, deltaTime float32) {
+	if !entity.Active || !entity.IsMoving {
+		return
+	}
 
-		dx := entity.TargetPosition.X - entity.Position.X
-		dy := entity.TargetPosition.Y - entity.Position.Y
-		dz := entity.TargetPosition.Z - entity.Position.Z
+	moveSpeed := entity.MoveSpeed
+	if moveSpeed <= 0 {
+		moveSpeed = 4.0
+	}
 
-		totalDistance := float32(0)
-		if dx != 0 {
-			totalDistance += dx * dx
-		}
-		if dy != 0 {
-			totalDistance += dy * dy
-		}
-		if dz != 0 {
-			totalDistance += dz * dz
-		}
+	moveDistance := moveSpeed * deltaTime
 
-		if totalDistance > 0 {
-			totalDistance = float32(sqrt(float64(totalDistance)))
-		}
+	dx := entity.TargetPosition.X - entity.Position.X
+	dy := entity.TargetPosition.Y - entity.Position.Y
+	dz := entity.TargetPosition.Z - entity.Position.Z
+
+	totalDistance := float32(0)
+	if dx != 0 {
+		totalDistance += dx * dx
+	}
+	if dy != 0 {
+		totalDistance += dy * dy
+	}
+	if dz != 0 {
+		totalDistance += dz * dz
+	}
+
+	if totalDistance > 0 {
+		totalDistance = float32(sqrt(float64(totalDistance)))
+	}
 
-		if moveDistance >= totalDistance {
-			entity.Position = entity.TargetPosition
-			entity.IsMoving = false
+	if moveDistance >= totalDistance {
+		entity.Position = entity.TargetPosition
+		entity.IsMoving = false
 
-			if entity.Type == EntityPlayer {
+		if entity == fg.Player {
+			fg.UpdatePlayerBounds()
+			fg.CheckInteractions()
+		} else {
+			fg.UpdateEntityBounds(entity)
+		}
+	} else {
+		if totalDistance > 0 {
+			moveRatio := moveDistance / totalDistance
+			entity.Position.X += dx * moveRatio
+			entity.Position.Y += dy * moveRatio
+			entity.Position.Z += dz * moveRatio
+
+			if entity == fg.Player {
 				fg.UpdatePlayerBounds()
-				fg.CheckInteractions()
 			} else {
 				fg.UpdateEntityBounds(entity)
 			}
-		} else {
-			if totalDistance > 0 {
-				moveRatio := moveDistance / totalDistance
-				entity.Position.X += dx * moveRatio
-				entity.Position.Y += dy * moveRatio
-				entity.Position.Z += dz * moveRatio
-
-				if entity.Type == EntityPlayer {
-					fg.UpdatePlayerBounds()
-				} else {
-					fg.UpdateEntityBounds(entity)
-				}
-			}
 		}
 	}
 }
@@ -144,14 +234,20 @@ func (fg *FilmationGame) CheckInteractions() {
 		entity := &fg.World.Entities[i]
 		if entity.Type == EntityItem && entity.Active {
 			if BoundingBoxesIntersect(fg.Player.Bounds, entity.Bounds) {
-				entity.Active = false
-				fg.ItemsCollected++
-				fmt.Printf("Picked up %s!\n", fg.getItemName(entity.SpriteID))
+				if fg.PickUp(entity) {
+					entity.Active = false
+					fg.ItemsCollected++
+					fg.FireHook(HookPickup, entity)
+				}
 			}
 		}
 	}
 
+	roomID := fg.Rooms.CurrentRoom
 	fg.CheckRoomTransitions()
+	if fg.Rooms.CurrentRoom == roomID {
+		fg.CheckStairs()
+	}
 }
 
 func (fg *FilmationGame) PlayerAttack() {
@@ -177,11 +273,12 @@ func (fg *FilmationGame) PlayerAttack() {
 		entity := &fg.World.Entities[i]
 		if entity.Type == EntityEnemy && entity.Active {
 			if BoundingBoxesIntersect(attackBounds, entity.Bounds) {
-				entity.Health--
+				entity.Health -= fg.PlayerDamage()
 				if entity.Health <= 0 {
 					entity.Active = false
 					fg.EnemiesKilled++
 					fmt.Printf("Enemy defeated! Total: %d\n", fg.EnemiesKilled)
+					fg.FireHook(HookEnemyKilled, entity)
 				}
 				break
 			}
@@ -189,14 +286,6 @@ func (fg *FilmationGame) PlayerAttack() {
 	}
 }
 
-func (fg *FilmationGame) getItemName(spriteID int) string {
-	names := []string{"Key", "Gem", "Potion", "Sword", "Shield", "Apple"}
-	if spriteID >= 0 && spriteID < len(names) {
-		return names[spriteID]
-	}
-	return "Item"
-}
-
 func sqrt(x float64) float64 {
 	if x == 0 {
 		return 0
@@ -208,35 +297,65 @@ func sqrt(x float64) float64 {
 	return z
 }
 
-func (fg *FilmationGame) Update() {
-	fg.GameTime += rl.GetFrameTime()
-	fg.AnimTime += rl.GetFrameTime()
-
-	fg.HandleInput()
-	fg.UpdateMovement()
-	fg.UpdateEnemies()
-	fg.CalculateRenderOrder()
+// ShowMessage puts a line of text on screen for a few seconds, and on the
+// console.
+func (fg *FilmationGame) ShowMessage(text string) {
+	fmt.Println(text)
+	fg.Message = text
+	fg.MessageTime = 3.0
 }
 
 func main() {
-	const screenWidth = 800
-	const screenHeight = 600
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			os.Exit(command(os.Args[2:]))
+		}
+	}
 
-	rl.InitWindow(screenWidth, screenHeight, "RETROMANSION")
-	rl.SetTargetFPS(60)
+	levelPath := flag.String("level", "./game_assets/levels/mansion.json", "level file, Tiled map or .vox model to load")
+	saveDir := flag.String("saves", "./saves", "directory for saved games")
+	seed := flag.Int64("seed", 0, "generate a random mansion from this seed instead of loading a level")
+	watch := flag.Bool("watch", false, "reload the level's scripts when they change")
+	configPath := flag.String("config", ConfigPath(), "file the options are kept in")
+	flag.Parse()
+
+	generate := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			generate = true
+		}
+	})
+
+	config, err := LoadConfig(*configPath)
+	if err != nil {
+		fmt.Printf("Bad options, using the defaults for:\n%v\n", err)
+	}
+
+	rl.InitWindow(config.Width*int32(config.WindowScale), config.Height*int32(config.WindowScale), "RETROMANSION")
+	// Escape pauses the game rather than closing the window.
+	rl.SetExitKey(rl.KeyNull)
 
 	// Initialize audio system for music support
 	rl.InitAudioDevice()
 	defer rl.CloseAudioDevice()
 
 	game := FilmationGame{
-		Scale:     54,
-		ScreenW:   screenWidth,
-		ScreenH:   screenHeight,
+		Scale:     config.TileScale,
+		ScreenW:   config.Width,
+		ScreenH:   config.Height,
 		AssetPath: "./game_assets/sprites",
+		LevelPath: *levelPath,
+		SaveDir:   *saveDir,
+		Generate:  generate,
+		Seed:      *seed,
+
+		WatchScripts: *watch,
+
+		Config:     config,
+		ConfigPath: *configPath,
 	}
 
-	err := game.LoadSprites()
+	err = game.LoadSprites()
 	if err != nil {
 		fmt.Printf("Failed to load sprites: %v\n", err)
 		rl.CloseWindow()
@@ -251,13 +370,11 @@ func main() {
 	} else {
 		game.StartMusic()
 	}
+	game.ApplyConfig()
 
-	game.BuildSampleRooms()
-	game.CalculateRenderOrder()
-
-	fmt.Println("World ready!")
+	game.SetState(StateTitle)
 
-	for !rl.WindowShouldClose() {
+	for !rl.WindowShouldClose() && !game.Quit {
 		// Update music stream each frame
 		game.UpdateMusic()
 		
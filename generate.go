@@ -0,0 +1,475 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+type MansionParams struct {
+	Seed  int64
+	Rooms int
+
+	MinWidth, MaxWidth int
+	MinDepth, MaxDepth int
+	Height             int
+
+	Floors []TileType
+	Walls  []TileType
+
+	// Densities are per walkable floor tile, so 0.05 in a room with 40 free
+	// tiles places two of them.
+	EnemyDensity float32
+	ItemDensity  float32
+
+	PillarChance    float32
+	PartitionChance float32
+	LockChance      float32
+}
+
+func DefaultMansionParams(seed int64) MansionParams {
+	return MansionParams{
+		Seed:            seed,
+		Rooms:           8,
+		MinWidth:        6,
+		MaxWidth:        12,
+		MinDepth:        6,
+		MaxDepth:        12,
+		Height:          3,
+		Floors:          []TileType{TileStoneFloor, TileWoodFloor, TileGrassFloor, TileSandFloor},
+		Walls:           []TileType{TileStoneWall, TileBrickWall, TileWoodWall, TileMetalWall},
+		EnemyDensity:    0.03,
+		ItemDensity:     0.03,
+		PillarChance:    0.5,
+		PartitionChance: 0.4,
+		LockChance:      0.3,
+	}
+}
+
+type mansionGenerator struct {
+	fg     *FilmationGame
+	params MansionParams
+	rng    *rand.Rand
+
+	children map[int][]int
+	locks    map[int]string
+	entityID int
+}
+
+// GenerateMansion builds a random mansion. The rooms form a tree joined by
+// two-way doors, so every room can be reached from the first one. Locked
+// doors only ever lead away from the first room, and their key is placed in
+// a room the player can already reach. The same parameters always build the
+// same mansion.
+func (fg *FilmationGame) GenerateMansion(params MansionParams) error {
+	if params.Rooms < 1 {
+		return fmt.Errorf("a mansion needs at least one room")
+	}
+	if params.MinWidth < 5 || params.MinDepth < 5 || params.MaxWidth < params.MinWidth || params.MaxDepth < params.MinDepth {
+		return fmt.Errorf("rooms must be at least 5x5 and the maximum size at least the minimum")
+	}
+	if params.Height < 2 {
+		return fmt.Errorf("rooms must be at least 2 tiles high")
+	}
+	if len(params.Floors) == 0 || len(params.Walls) == 0 {
+		return fmt.Errorf("the floor and wall palettes must not be empty")
+	}
+
+	fmt.Printf("Generating mansion from seed %d...\n", params.Seed)
+
+	gen := &mansionGenerator{
+		fg:       fg,
+		params:   params,
+		rng:      rand.New(rand.NewSource(params.Seed)),
+		children: make(map[int][]int),
+		locks:    make(map[int]string),
+	}
+
+	fg.InitRoomSystem()
+
+	for id := 1; id <= params.Rooms; id++ {
+		gen.buildRoom(id)
+	}
+
+	for id := 2; id <= params.Rooms; id++ {
+		if err := gen.connect(id); err != nil {
+			return err
+		}
+	}
+
+	for id := 1; id <= params.Rooms; id++ {
+		gen.addFeatures(fg.Rooms.Rooms[id])
+	}
+
+	start := gen.placeStart()
+	if err := gen.placeKeys(start); err != nil {
+		return err
+	}
+	for id := 1; id <= params.Rooms; id++ {
+		gen.populate(fg.Rooms.Rooms[id], start)
+	}
+
+	fg.SetupPlayerInRoom(1, start)
+
+	fmt.Printf("Generated %d rooms\n", len(fg.Rooms.Rooms))
+	return nil
+}
+
+func (gen *mansionGenerator) between(lo, hi int) int {
+	return lo + gen.rng.Intn(hi-lo+1)
+}
+
+func (gen *mansionGenerator) buildRoom(id int) {
+	p := gen.params
+	width := gen.between(p.MinWidth, p.MaxWidth)
+	depth := gen.between(p.MinDepth, p.MaxDepth)
+	floor := p.Floors[gen.rng.Intn(len(p.Floors))]
+	wall := p.Walls[gen.rng.Intn(len(p.Walls))]
+
+	room := gen.fg.CreateRoom(id, fmt.Sprintf("Room %d", id), width, p.Height, depth)
+	gen.fg.BuildBasicRoom(room, floor)
+
+	for x := 0; x < width; x++ {
+		for z := 0; z < depth; z++ {
+			if room.World.Tiles[x][1][z].Type == TileStoneWall {
+				room.World.Tiles[x][1][z] = NewTile(wall, x, 1, z)
+			}
+		}
+	}
+}
+
+// doorSpot is a door on a room's wall together with the cell just inside
+// it, where a player coming through the door arrives.
+type doorSpot struct {
+	door, inside Point3D
+}
+
+// wallSpots lists the places a door could go on one wall of a room: not in
+// a corner, not on or next to another door.
+func wallSpots(room *Room, side Direction) []doorSpot {
+	w, d := room.World.Width, room.World.Depth
+	var spots []doorSpot
+
+	add := func(x, z, ix, iz int) {
+		for _, n := range [][2]int{{x, z}, {x - 1, z}, {x + 1, z}, {x, z - 1}, {x, z + 1}} {
+			if n[0] >= 0 && n[0] < w && n[1] >= 0 && n[1] < d && room.World.Tiles[n[0]][1][n[1]].Type == TileDoor {
+				return
+			}
+		}
+		spots = append(spots, doorSpot{
+			door:   Point3D{X: float32(x), Y: 1, Z: float32(z)},
+			inside: Point3D{X: float32(ix), Y: 1, Z: float32(iz)},
+		})
+	}
+
+	switch side {
+	case DirLeft:
+		for z := 1; z < d-1; z++ {
+			add(0, z, 1, z)
+		}
+	case DirRight:
+		for z := 1; z < d-1; z++ {
+			add(w-1, z, w-2, z)
+		}
+	case DirUp:
+		for x := 1; x < w-1; x++ {
+			add(x, 0, x, 1)
+		}
+	case DirDown:
+		for x := 1; x < w-1; x++ {
+			add(x, d-1, x, d-2)
+		}
+	}
+	return spots
+}
+
+func oppositeDirection(dir Direction) Direction {
+	switch dir {
+	case DirLeft:
+		return DirRight
+	case DirRight:
+		return DirLeft
+	case DirUp:
+		return DirDown
+	}
+	return DirUp
+}
+
+// connect joins a room to a random room built before it, so the rooms form
+// a tree rooted at room 1.
+func (gen *mansionGenerator) connect(id int) error {
+	child := gen.fg.Rooms.Rooms[id]
+	sides := []Direction{DirDown, DirLeft, DirUp, DirRight}
+
+	for attempt := 0; attempt < 50; attempt++ {
+		parentID := 1 + gen.rng.Intn(id-1)
+		parent := gen.fg.Rooms.Rooms[parentID]
+		side := sides[gen.rng.Intn(len(sides))]
+
+		parentSpots := wallSpots(parent, side)
+		childSpots := wallSpots(child, oppositeDirection(side))
+		if len(parentSpots) == 0 || len(childSpots) == 0 {
+			continue
+		}
+		out := parentSpots[gen.rng.Intn(len(parentSpots))]
+		back := childSpots[gen.rng.Intn(len(childSpots))]
+
+		locked := gen.rng.Float32() < gen.params.LockChance
+		gen.fg.AddRoomConnection(parentID, id, out.door, back.inside, side, locked)
+		if locked {
+			key := keyColorNames[len(gen.locks)%len(keyColorNames)]
+			parent.Connections[len(parent.Connections)-1].Key = key
+			gen.locks[id] = key
+		}
+		gen.fg.AddRoomConnection(id, parentID, back.door, out.inside, oppositeDirection(side), false)
+
+		gen.children[parentID] = append(gen.children[parentID], id)
+		return nil
+	}
+
+	return fmt.Errorf("could not find room for a door into room %d", id)
+}
+
+// doorsConnected reports whether every door of a room can still be reached
+// from every other.
+func doorsConnected(room *Room) bool {
+	var doors []Point3D
+	for x := 0; x < room.World.Width; x++ {
+		for z := 0; z < room.World.Depth; z++ {
+			if room.World.Tiles[x][1][z].Type == TileDoor {
+				doors = append(doors, Point3D{X: float32(x), Y: 1, Z: float32(z)})
+			}
+		}
+	}
+	if len(doors) < 2 {
+		return true
+	}
+
+	seen := RoomReachable(&room.World, doors[0])
+	for _, door := range doors[1:] {
+		if !reachedCell(seen, door) {
+			return false
+		}
+	}
+	return true
+}
+
+// addFeatures puts pillars and partition walls into a room, keeping only
+// the ones that leave all of its doors connected.
+func (gen *mansionGenerator) addFeatures(room *Room) {
+	w, d := room.World.Width, room.World.Depth
+
+	try := func(cells [][2]int, tileType TileType) {
+		var old []Tile3D
+		for _, c := range cells {
+			old = append(old, room.World.Tiles[c[0]][1][c[1]])
+			room.World.Tiles[c[0]][1][c[1]] = NewTile(tileType, c[0], 1, c[1])
+		}
+		if !doorsConnected(room) || !gen.doorwaysClear(room) {
+			for i, c := range cells {
+				room.World.Tiles[c[0]][1][c[1]] = old[i]
+			}
+		}
+	}
+
+	for i := 0; i < (w*d)/30+1; i++ {
+		if gen.rng.Float32() < gen.params.PillarChance {
+			x, z := gen.between(2, w-3), gen.between(2, d-3)
+			try([][2]int{{x, z}}, TilePillar)
+		}
+	}
+
+	if gen.rng.Float32() < gen.params.PartitionChance {
+		var cells [][2]int
+		if gen.rng.Intn(2) == 0 {
+			z := gen.between(2, d-3)
+			from := gen.between(1, w/2)
+			for x := from; x < from+w/2 && x < w-1; x++ {
+				cells = append(cells, [2]int{x, z})
+			}
+		} else {
+			x := gen.between(2, w-3)
+			from := gen.between(1, d/2)
+			for z := from; z < from+d/2 && z < d-1; z++ {
+				cells = append(cells, [2]int{x, z})
+			}
+		}
+		try(cells, TileBrickWall)
+	}
+}
+
+// doorwaysClear checks that the arrival cell of every connection into this
+// room is free.
+func (gen *mansionGenerator) doorwaysClear(room *Room) bool {
+	for id := 1; id <= gen.params.Rooms; id++ {
+		other := gen.fg.Rooms.Rooms[id]
+		for _, conn := range other.Connections {
+			if conn.ToRoomID != room.ID {
+				continue
+			}
+			tile := room.World.Tiles[int(conn.ToPosition.X)][1][int(conn.ToPosition.Z)]
+			if tile.Type != TileEmpty && tile.Solid {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// freeCells lists the cells at Y level 1 that can be reached from the room's
+// doors (or its middle, for a room without doors) and hold nothing: no
+// tile, no entity, and not the inside of a doorway.
+func (gen *mansionGenerator) freeCells(room *Room, avoid []Point3D) []Point3D {
+	from := Point3D{X: float32(room.World.Width / 2), Y: 1, Z: float32(room.World.Depth / 2)}
+	if len(room.Connections) > 0 {
+		from = stepInside(room.Connections[0])
+	}
+	seen := RoomReachable(&room.World, from)
+
+	blocked := make(map[Point3D]bool)
+	for _, p := range avoid {
+		blocked[p] = true
+	}
+	for _, e := range room.World.Entities {
+		blocked[e.Position] = true
+	}
+	for id := 1; id <= gen.params.Rooms; id++ {
+		for _, conn := range gen.fg.Rooms.Rooms[id].Connections {
+			if conn.ToRoomID == room.ID {
+				blocked[conn.ToPosition] = true
+			}
+		}
+	}
+
+	var cells []Point3D
+	for z := 1; z < room.World.Depth-1; z++ {
+		for x := 1; x < room.World.Width-1; x++ {
+			p := Point3D{X: float32(x), Y: 1, Z: float32(z)}
+			if seen[x][1][z] && room.World.Tiles[x][1][z].Type == TileEmpty && !blocked[p] {
+				cells = append(cells, p)
+			}
+		}
+	}
+	return cells
+}
+
+// stepInside is the cell next to a door on the room's side of the wall. The
+// connection's direction is the way the player walks out through it.
+func stepInside(conn RoomConnection) Point3D {
+	p := conn.Position
+	switch conn.Direction {
+	case DirLeft:
+		p.X++
+	case DirRight:
+		p.X--
+	case DirUp:
+		p.Z++
+	case DirDown:
+		p.Z--
+	}
+	return p
+}
+
+func (gen *mansionGenerator) placeStart() Point3D {
+	room := gen.fg.Rooms.Rooms[1]
+	cells := gen.freeCells(room, nil)
+	if len(cells) == 0 {
+		return Point3D{X: 1, Y: 1, Z: 1}
+	}
+	return cells[gen.rng.Intn(len(cells))]
+}
+
+func (gen *mansionGenerator) addEntity(room *Room, entityType EntityType, pos Point3D, spriteID int) *GameEntity {
+	entity := NewEntity(gen.entityID, entityType, pos, spriteID)
+	if entityType == EntityEnemy {
+		entity.MoveSpeed = 2.0
+		entity.MoveTimer = 1.0 + gen.rng.Float32()*2
+	}
+	room.World.Entities = append(room.World.Entities, entity)
+	gen.entityID++
+	return &room.World.Entities[len(room.World.Entities)-1]
+}
+
+// placeKeys walks the room tree outwards from room 1. Every locked door met
+// on the way gets its key in one of the rooms already reached, so the key is
+// always found before the door it opens. A room is picked at random a few
+// times, and then each reached room is tried in turn; a key that fits in
+// none of them is an error, rather than a door that can never be opened.
+// No key is put where the player starts.
+func (gen *mansionGenerator) placeKeys(start Point3D) error {
+	reached := []int{1}
+	for i := 0; i < len(reached); i++ {
+		for _, child := range gen.children[reached[i]] {
+			if key, ok := gen.locks[child]; ok && !gen.placeKey(reached, key, start) {
+				return fmt.Errorf("no room before room %d has space for its key %q", child, key)
+			}
+			reached = append(reached, child)
+		}
+	}
+	return nil
+}
+
+func (gen *mansionGenerator) placeKey(reached []int, key string, start Point3D) bool {
+	place := func(id int) bool {
+		room := gen.fg.Rooms.Rooms[id]
+		var avoid []Point3D
+		if id == 1 {
+			avoid = append(avoid, start)
+		}
+		cells := gen.freeCells(room, avoid)
+		if len(cells) == 0 {
+			return false
+		}
+		gen.addEntity(room, EntityItem, cells[gen.rng.Intn(len(cells))], keySpriteID).Key = key
+		return true
+	}
+
+	for attempt := 0; attempt < len(reached)*2; attempt++ {
+		if place(reached[gen.rng.Intn(len(reached))]) {
+			return true
+		}
+	}
+	for _, id := range reached {
+		if place(id) {
+			return true
+		}
+	}
+	return false
+}
+
+func (gen *mansionGenerator) populate(room *Room, start Point3D) {
+	var avoid []Point3D
+	if room.ID == 1 {
+		avoid = append(avoid, start)
+	}
+	free := len(gen.freeCells(room, avoid))
+	enemies := int(gen.params.EnemyDensity*float32(free) + gen.rng.Float32())
+	items := int(gen.params.ItemDensity*float32(free) + gen.rng.Float32())
+
+	for i := 0; i < enemies+items; i++ {
+		cells := gen.freeCells(room, avoid)
+		if room.ID == 1 {
+			cells = awayFrom(cells, start, 3)
+		}
+		if len(cells) == 0 {
+			return
+		}
+		pos := cells[gen.rng.Intn(len(cells))]
+		if i < enemies {
+			gen.addEntity(room, EntityEnemy, pos, gen.rng.Intn(len(enemySpriteNames)))
+		} else {
+			gen.addEntity(room, EntityItem, pos, 1+gen.rng.Intn(len(itemSpriteNames)-1))
+		}
+	}
+}
+
+// awayFrom drops the cells within a few steps of a point, so the player does
+// not start next to an enemy.
+func awayFrom(cells []Point3D, p Point3D, steps float32) []Point3D {
+	var out []Point3D
+	for _, c := range cells {
+		if abs(c.X-p.X)+abs(c.Z-p.Z) > steps {
+			out = append(out, c)
+		}
+	}
+	return out
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// TestGenerateSameSeed checks that a seed always gives the same mansion,
+// and another seed a different one.
+func TestGenerateSameSeed(t *testing.T) {
+	generate := func(seed int64) []byte {
+		fg := &FilmationGame{}
+		if err := fg.GenerateMansion(DefaultMansionParams(seed)); err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+		level := fg.EncodeLevel()
+		data, err := MarshalLevel(&level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	for seed := int64(1); seed <= 5; seed++ {
+		if !bytes.Equal(generate(seed), generate(seed)) {
+			t.Errorf("seed %d gave two different mansions", seed)
+		}
+	}
+	if bytes.Equal(generate(1), generate(2)) {
+		t.Error("seeds 1 and 2 gave the same mansion")
+	}
+}
+
+// TestGenerateKeysBeforeLocks plays each generated mansion from room 1,
+// picking up every key in the rooms reached and using one up for each
+// locked door opened, and checks that every room can be reached.
+func TestGenerateKeysBeforeLocks(t *testing.T) {
+	for seed := int64(1); seed <= 50; seed++ {
+		params := DefaultMansionParams(seed)
+		params.Rooms = 3 + int(seed%10)
+		params.LockChance = 0.6
+		fg := &FilmationGame{}
+		if err := fg.GenerateMansion(params); err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+
+		keys := make(map[string]int)
+		reached := make(map[int]bool)
+		enter := func(id int) {
+			reached[id] = true
+			for _, entity := range fg.Rooms.Rooms[id].World.Entities {
+				if entity.Type == EntityItem && entity.Key != "" {
+					keys[entity.Key]++
+				}
+			}
+		}
+		enter(1)
+		for _, entity := range fg.Rooms.Rooms[1].World.Entities {
+			if entity.Position == fg.Player.Position {
+				t.Fatalf("seed %d: the player starts on a %s", seed, entityTypeNames[entity.Type])
+			}
+		}
+		for opened := true; opened; {
+			opened = false
+			for id := range reached {
+				for _, conn := range fg.Rooms.Rooms[id].Connections {
+					if reached[conn.ToRoomID] || conn.RequiresKey && keys[conn.Key] == 0 {
+						continue
+					}
+					if conn.RequiresKey {
+						keys[conn.Key]--
+					}
+					enter(conn.ToRoomID)
+					opened = true
+				}
+			}
+		}
+		if len(reached) != len(fg.Rooms.Rooms) {
+			t.Fatalf("seed %d: reached %d of %d rooms", seed, len(reached), len(fg.Rooms.Rooms))
+		}
+	}
+}
+
+// TestGenerateKeyWithNoSpace checks that a key with nowhere to go is an
+// error rather than a door that can never be opened, and that the cell the
+// player starts on is not somewhere to go.
+func TestGenerateKeyWithNoSpace(t *testing.T) {
+	fg := &FilmationGame{}
+	fg.InitRoomSystem()
+	hall := fg.CreateRoom(1, "Hall", 5, 3, 5)
+	fg.BuildBasicRoom(hall, TileStoneFloor)
+	for x := 1; x < 4; x++ {
+		for z := 1; z < 4; z++ {
+			hall.World.Tiles[x][1][z] = NewTile(TilePillar, x, 1, z)
+		}
+	}
+	fg.BuildBasicRoom(fg.CreateRoom(2, "Vault", 5, 3, 5), TileStoneFloor)
+
+	params := DefaultMansionParams(1)
+	params.Rooms = 2
+	gen := &mansionGenerator{
+		fg:       fg,
+		params:   params,
+		rng:      rand.New(rand.NewSource(1)),
+		children: map[int][]int{1: {2}},
+		locks:    map[int]string{2: "red"},
+	}
+	start := Point3D{X: 2, Y: 1, Z: 2}
+	hall.World.Tiles[2][1][2] = Tile3D{}
+	if err := gen.placeKeys(start); err == nil {
+		t.Fatal("placed a key where the player starts")
+	}
+
+	hall.World.Tiles[2][1][3] = Tile3D{}
+	if err := gen.placeKeys(start); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(hall.World.Entities); n != 1 || hall.World.Entities[0].Key != "red" {
+		t.Fatalf("got %+v", hall.World.Entities)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+// Creatures and blocks fall. Each frame, an entity that is not resting on
+// something is pulled down until it lands on the highest thing below it: a
+// floor, the top of a wall or pillar, an enemy, a block or a platform. Entities move
+// between cells one step at a time, as before; falling and jumping only
+// change Y, so a jump made while stepping carries the entity forward.
+//
+// An entity at level y stands on whatever is at level y-1. Floors and
+// ceilings are walked over rather than into, so besides being something to
+// stand on they stop entities moving into their cell, from the side or from
+// below.
+
+const (
+	gravity      = 20.0 // cells per second per second
+	jumpSpeed    = 7.0  // cells per second, enough to clear one level
+	maxFallSpeed = 15.0
+)
+
+func isSlab(t TileType) bool {
+	switch t {
+	case TileStoneFloor, TileWoodFloor, TileGrassFloor, TileSandFloor, TileCeiling:
+		return true
+	}
+	return false
+}
+
+// blocksAt reports whether nothing can be inside the cell: it is outside
+// the world, holds a solid tile, or is a floor or ceiling.
+func (w *World3D) blocksAt(x, y, z int) bool {
+	if w.IsTileSolid(x, y, z) {
+		return true
+	}
+	return isSlab(w.Tiles[x][y][z].Type)
+}
+
+// supports reports whether the tile in a cell can be stood on. Below the
+// world counts as ground, so nothing falls out of a room.
+func (w *World3D) supports(x, y, z int) bool {
+	if y < 0 {
+		return true
+	}
+	return x >= 0 && x < w.Width && y < w.Height && z >= 0 && z < w.Depth && w.blocksAt(x, y, z)
+}
+
+func cellOf(p Point3D) [3]int {
+	return [3]int{int(p.X + 0.5), int(p.Y + 0.5), int(p.Z + 0.5)}
+}
+
+// restLevel is the level an entity at height y above the cell (x, z) comes
+// to rest on: the highest level at or below it with a tile underneath. An
+// entity that has ended up inside a tile is lifted out of it first.
+func (w *World3D) restLevel(x, z int, y float32) int {
+	level := int(y + 0.5)
+	for level < w.Height-1 && w.blocksAt(x, level, z) {
+		level++
+	}
+	for level > 0 && !w.supports(x, level-1, z) {
+		level--
+	}
+	return level
+}
+
+// restHeight is the height an entity comes to rest at: on the tiles below
+// it, or on top of an enemy, block or platform below it if that is higher.
+// Platforms move smoothly, so what stands on them need not be on a level.
+func (w *World3D) restHeight(self *GameEntity) float32 {
+	cell := cellOf(self.Position)
+	rest := float32(w.restLevel(cell[0], cell[2], self.Position.Y))
+
+	for i := range w.Entities {
+		entity := &w.Entities[i]
+		if entity == self || !isSolidEntity(entity) {
+			continue
+		}
+		under := cellOf(entity.Position)
+		top := entity.Position.Y + 1
+		if under[0] == cell[0] && under[2] == cell[2] && top <= self.Position.Y+0.5 && top > rest {
+			rest = top
+		}
+	}
+	return rest
+}
+
+// OnGround reports whether an entity is resting on something.
+func (fg *FilmationGame) OnGround(entity *GameEntity) bool {
+	return entity.VelocityY == 0 && entity.Position.Y == fg.World.restHeight(entity)
+}
+
+// Jump launches an entity upwards if it is standing on something.
+func (fg *FilmationGame) Jump(entity *GameEntity) bool {
+	if !fg.OnGround(entity) {
+		return false
+	}
+	entity.VelocityY = jumpSpeed
+	return true
+}
+
+// applyGravity moves an entity up or down for one frame: rising until it
+// hits something overhead, then falling until it lands.
+func (fg *FilmationGame) applyGravity(entity *GameEntity, deltaTime float32) {
+	if !entity.Active {
+		return
+	}
+
+	w := &fg.World
+	cell := cellOf(entity.Position)
+	rest := w.restHeight(entity)
+	if entity.VelocityY == 0 && entity.Position.Y == rest {
+		return
+	}
+
+	entity.VelocityY = max(entity.VelocityY-gravity*deltaTime, -maxFallSpeed)
+	y := entity.Position.Y + entity.VelocityY*deltaTime
+
+	if entity.VelocityY > 0 {
+		if head := int(y + 0.5); head > cell[1] && (head >= w.Height || w.blocksAt(cell[0], head, cell[2])) {
+			y = float32(head - 1)
+			entity.VelocityY = 0
+		}
+	}
+	if y <= rest {
+		y = rest
+		entity.VelocityY = 0
+	}
+
+	entity.Position.Y = y
+	entity.TargetPosition.Y = y
+	if entity == fg.Player {
+		fg.UpdatePlayerBounds()
+	} else {
+		fg.UpdateEntityBounds(entity)
+	}
+}
+
+// fallsWithGravity reports whether gravity moves an entity. Items stay where
+// they are put.
+func fallsWithGravity(entity *GameEntity) bool {
+	switch entity.Type {
+	case EntityPlayer, EntityEnemy, EntityNPC, EntityBlock:
+		return true
+	}
+	return false
+}
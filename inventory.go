@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type EquipSlot int
+
+const (
+	SlotNone EquipSlot = iota
+	SlotWeapon
+	SlotShield
+)
+
+var equipSlotNames = map[EquipSlot]string{
+	SlotWeapon: "weapon",
+	SlotShield: "shield",
+}
+
+// ItemDef says what an item does. Items are identified by their sprite.
+type ItemDef struct {
+	Name     string
+	MaxStack int
+
+	// Heal is the health restored by using the item.
+	Heal int
+
+	// Equipment goes in Slot. While it is worn, Attack is added to the
+	// damage of each hit the player lands, and Defense is the fraction of
+	// the damage the player takes that it blocks.
+	Slot    EquipSlot
+	Attack  int
+	Defense float32
+}
+
+var itemDefs = map[int]ItemDef{
+	0: {Name: "Key", MaxStack: 1},
+	1: {Name: "Gem", MaxStack: 99},
+	2: {Name: "Potion", MaxStack: 5, Heal: 5},
+	3: {Name: "Sword", MaxStack: 1, Slot: SlotWeapon, Attack: 1},
+	4: {Name: "Shield", MaxStack: 1, Slot: SlotShield, Defense: 0.5},
+	5: {Name: "Apple", MaxStack: 5, Heal: 2},
+}
+
+func itemDef(spriteID int) ItemDef {
+	if def, ok := itemDefs[spriteID]; ok {
+		return def
+	}
+	return ItemDef{Name: "Item", MaxStack: 1}
+}
+
+const DefaultInventoryCapacity = 8
+
+type InventoryStack struct {
+	SpriteID int
+	Count    int
+}
+
+// Inventory holds what the player carries. Keys are not kept here but on
+// the key ring, FilmationGame.Keys. The zero Inventory is empty and holds
+// DefaultInventoryCapacity stacks.
+type Inventory struct {
+	Capacity int
+	Stacks   []InventoryStack
+
+	// Equipped holds the sprite ID of the item worn in each slot. Worn
+	// items are not in Stacks.
+	Equipped map[EquipSlot]int
+}
+
+func (inv *Inventory) capacity() int {
+	if inv.Capacity <= 0 {
+		return DefaultInventoryCapacity
+	}
+	return inv.Capacity
+}
+
+// hotkeys is how many stacks the number keys reach, from 1 up to 9.
+func (inv *Inventory) hotkeys() int {
+	return min(inv.capacity(), 9)
+}
+
+// Add puts one item in the inventory, on an existing stack if one has room.
+// It reports false if the inventory is full.
+func (inv *Inventory) Add(spriteID int) bool {
+	def := itemDef(spriteID)
+	for i := range inv.Stacks {
+		if inv.Stacks[i].SpriteID == spriteID && inv.Stacks[i].Count < def.MaxStack {
+			inv.Stacks[i].Count++
+			return true
+		}
+	}
+	if len(inv.Stacks) >= inv.capacity() {
+		return false
+	}
+	inv.Stacks = append(inv.Stacks, InventoryStack{SpriteID: spriteID, Count: 1})
+	return true
+}
+
+// take removes one item from a stack, dropping the stack when it runs out.
+func (inv *Inventory) take(index int) {
+	inv.Stacks[index].Count--
+	if inv.Stacks[index].Count <= 0 {
+		inv.Stacks = append(inv.Stacks[:index], inv.Stacks[index+1:]...)
+	}
+}
+
+func (inv *Inventory) equipped(slot EquipSlot) (ItemDef, bool) {
+	spriteID, ok := inv.Equipped[slot]
+	if !ok {
+		return ItemDef{}, false
+	}
+	return itemDef(spriteID), true
+}
+
+func (inv *Inventory) Attack() int {
+	attack := 0
+	for slot := range inv.Equipped {
+		def, _ := inv.equipped(slot)
+		attack += def.Attack
+	}
+	return attack
+}
+
+func (inv *Inventory) Defense() float32 {
+	defense := float32(0)
+	for slot := range inv.Equipped {
+		def, _ := inv.equipped(slot)
+		defense += def.Defense
+	}
+	return min(defense, 1)
+}
+
+// PickUp takes an item off the floor. Keys go on the key ring and
+// everything else in the inventory. It reports false, and leaves the item
+// where it is, if the inventory is full.
+func (fg *FilmationGame) PickUp(entity *GameEntity) bool {
+	def := itemDef(entity.SpriteID)
+	if isKey(entity) {
+		fg.PickUpKey(entity.Key)
+		fmt.Printf("Picked up %s!\n", keyName(entity.Key))
+		return true
+	}
+
+	if !fg.Inventory.Add(entity.SpriteID) {
+		fg.ShowMessage(fmt.Sprintf("No room for the %s.", strings.ToLower(def.Name)))
+		return false
+	}
+	fmt.Printf("Picked up %s!\n", def.Name)
+	return true
+}
+
+// UseItem uses the item in an inventory slot: food and potions restore
+// health, and equipment is worn, swapping out whatever was in its slot.
+func (fg *FilmationGame) UseItem(index int) {
+	inv := &fg.Inventory
+	if index < 0 || index >= len(inv.Stacks) {
+		return
+	}
+	spriteID := inv.Stacks[index].SpriteID
+	def := itemDef(spriteID)
+
+	switch {
+	case def.Heal > 0:
+		if fg.Player.Health >= fg.Player.MaxHealth {
+			fg.ShowMessage("You are already at full health.")
+			return
+		}
+		inv.take(index)
+		fg.Player.Health = min(fg.Player.Health+def.Heal, fg.Player.MaxHealth)
+		fg.ShowMessage(fmt.Sprintf("The %s restores your health to %d.", strings.ToLower(def.Name), fg.Player.Health))
+
+	case def.Slot != SlotNone:
+		inv.take(index)
+		if old, ok := inv.Equipped[def.Slot]; ok {
+			inv.Add(old)
+		}
+		if inv.Equipped == nil {
+			inv.Equipped = make(map[EquipSlot]int)
+		}
+		inv.Equipped[def.Slot] = spriteID
+		fg.ShowMessage(fmt.Sprintf("You equip the %s.", strings.ToLower(def.Name)))
+
+	default:
+		fg.ShowMessage(fmt.Sprintf("You can't use the %s.", strings.ToLower(def.Name)))
+	}
+}
+
+// PlayerDamage is the damage each of the player's hits does.
+func (fg *FilmationGame) PlayerDamage() int {
+	return 1 + fg.Inventory.Attack()
+}
+
+// DamagePlayer takes health from the player, less what their equipment
+// blocks. Blocked fractions carry over, so a shield that blocks half the
+// damage turns every other hit aside. The difficulty scales the damage
+// first.
+func (fg *FilmationGame) DamagePlayer(amount int) {
+	scale, ok := difficultyDamage[fg.Config.Difficulty]
+	if !ok {
+		scale = 1
+	}
+	fg.damageCarry += float32(amount) * scale * (1 - fg.Inventory.Defense())
+	taken := int(fg.damageCarry)
+	fg.damageCarry -= float32(taken)
+	fg.Player.Health -= taken
+}
+
+// inventoryLine describes the inventory for the HUD.
+func (fg *FilmationGame) inventoryLine() string {
+	var parts []string
+	for i, stack := range fg.Inventory.Stacks {
+		part := fmt.Sprintf("%d:%s", i+1, itemDef(stack.SpriteID).Name)
+		if stack.Count > 1 {
+			part += fmt.Sprintf(" x%d", stack.Count)
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return "empty"
+	}
+	return strings.Join(parts, "  ")
+}
+
+func (fg *FilmationGame) equipmentLine() string {
+	var parts []string
+	for _, slot := range []EquipSlot{SlotWeapon, SlotShield} {
+		name := "-"
+		if def, ok := fg.Inventory.equipped(slot); ok {
+			name = def.Name
+		}
+		parts = append(parts, fmt.Sprintf("%s: %s", strings.ToUpper(equipSlotNames[slot]), name))
+	}
+	return strings.Join(parts, " | ")
+}
+
+// parseItemName reads an item as scripts and dialogues name it: by sprite,
+// such as "potion", or as "key" for a plain key and "key:red" for a named
+// one.
+func parseItemName(name string) (spriteID int, key string, ok bool) {
+	if name, key, named := strings.Cut(name, ":"); named {
+		return keySpriteID, key, name == "key" && key != ""
+	}
+	spriteID, ok = ParseSpriteName(EntityItem, name)
+	return spriteID, "", ok
+}
+
+// CountItem reports how many of an item the player has, carried or worn.
+func (fg *FilmationGame) CountItem(name string) int {
+	spriteID, key, _ := parseItemName(name)
+	if spriteID == keySpriteID {
+		return fg.Keys[key]
+	}
+	count := 0
+	for _, stack := range fg.Inventory.Stacks {
+		if stack.SpriteID == spriteID {
+			count += stack.Count
+		}
+	}
+	for _, worn := range fg.Inventory.Equipped {
+		if worn == spriteID {
+			count++
+		}
+	}
+	return count
+}
+
+// GiveItem hands the player count of an item. What does not fit in the
+// inventory is left on the floor at their feet.
+func (fg *FilmationGame) GiveItem(name string, count int) {
+	spriteID, key, _ := parseItemName(name)
+	cell := cellOf(fg.Player.Position)
+	feet := Point3D{X: float32(cell[0]), Y: float32(cell[1]), Z: float32(cell[2])}
+	for range count {
+		if spriteID == keySpriteID {
+			fg.PickUpKey(key)
+		} else if !fg.Inventory.Add(spriteID) {
+			fg.World.Entities = append(fg.World.Entities, NewEntity(fg.nextEntityID(), EntityItem, feet, spriteID))
+		}
+	}
+}
+
+// TakeItem takes up to count of an item from the player, carried ones
+// before worn ones.
+func (fg *FilmationGame) TakeItem(name string, count int) {
+	spriteID, key, _ := parseItemName(name)
+	inv := &fg.Inventory
+	for ; count > 0 && fg.CountItem(name) > 0; count-- {
+		if spriteID == keySpriteID {
+			fg.Keys[key]--
+			if fg.Keys[key] == 0 {
+				delete(fg.Keys, key)
+			}
+			continue
+		}
+
+		index := slices.IndexFunc(inv.Stacks, func(stack InventoryStack) bool { return stack.SpriteID == spriteID })
+		if index >= 0 {
+			inv.take(index)
+			continue
+		}
+		for slot, worn := range inv.Equipped {
+			if worn == spriteID {
+				delete(inv.Equipped, slot)
+				break
+			}
+		}
+	}
+}
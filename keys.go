@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// Keys are items with the key sprite. Each key has a name, stored in
+// GameEntity.Key, and a locked door opens only for a key with the same name.
+// The name can be left empty for a plain key that opens plain locked doors.
+//
+// Keys named after one of these colours are drawn in that colour.
+var keyColors = map[string]rl.Color{
+	"red":    {R: 230, G: 60, B: 60, A: 255},
+	"blue":   {R: 80, G: 120, B: 255, A: 255},
+	"green":  {R: 70, G: 200, B: 90, A: 255},
+	"yellow": {R: 240, G: 220, B: 60, A: 255},
+	"purple": {R: 180, G: 90, B: 220, A: 255},
+	"silver": {R: 200, G: 200, B: 210, A: 255},
+}
+
+// keyColorNames lists the key colours in the order the generator hands them
+// out.
+var keyColorNames = []string{"red", "blue", "green", "yellow", "purple", "silver"}
+
+func isKey(entity *GameEntity) bool {
+	return entity.Type == EntityItem && entity.SpriteID == keySpriteID
+}
+
+// keyName describes a key in a message, such as "the red key" or "a key".
+func keyName(key string) string {
+	if key == "" {
+		return "a key"
+	}
+	return fmt.Sprintf("the %s key", key)
+}
+
+// PickUpKey adds a key to the ones the player is carrying.
+func (fg *FilmationGame) PickUpKey(key string) {
+	if fg.Keys == nil {
+		fg.Keys = make(map[string]int)
+	}
+	fg.Keys[key]++
+}
+
+// Unlock opens a locked door if the player carries its key. A door that
+// consumes its key takes it from the player. Once open, a door stays open.
+func (fg *FilmationGame) Unlock(conn *RoomConnection) bool {
+	if !conn.RequiresKey {
+		return true
+	}
+	if fg.Keys[conn.Key] == 0 {
+		fg.ShowMessage(fmt.Sprintf("You need %s to open this door!", keyName(conn.Key)))
+		return false
+	}
+
+	if conn.ConsumeKey {
+		fg.Keys[conn.Key]--
+		if fg.Keys[conn.Key] == 0 {
+			delete(fg.Keys, conn.Key)
+		}
+	}
+	conn.RequiresKey = false
+	fg.ShowMessage(fmt.Sprintf("You unlock the door with %s.", keyName(conn.Key)))
+	return true
+}
+
+// IsDoorLocked reports whether a door tile in the current room belongs to a
+// connection that still needs a key.
+func (fg *FilmationGame) IsDoorLocked(pos Point3D) bool {
+	room := fg.Rooms.Rooms[fg.Rooms.CurrentRoom]
+	if room == nil {
+		return false
+	}
+	for _, conn := range room.Connections {
+		if conn.Active && conn.RequiresKey && conn.Position == pos {
+			return true
+		}
+	}
+	return false
+}
+
+// keyList describes the keys the player carries, for the HUD.
+func (fg *FilmationGame) keyList() string {
+	var names []string
+	for key, count := range fg.Keys {
+		name := key
+		if name == "" {
+			name = "plain"
+		}
+		if count > 1 {
+			name = fmt.Sprintf("%s x%d", name, count)
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
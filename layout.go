@@ -0,0 +1,587 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Room layouts are text files that draw a room one Y level at a time. The
+// format is documented in docs/level_format.md.
+
+type LayoutSymbol struct {
+	Tile   LevelTile
+	Entity *LevelEntity
+}
+
+var defaultLayoutLegend = map[rune]TileType{
+	'.': TileEmpty,
+	'_': TileStoneFloor,
+	'=': TileWoodFloor,
+	',': TileGrassFloor,
+	'~': TileSandFloor,
+	'#': TileStoneWall,
+	'B': TileBrickWall,
+	'W': TileWoodWall,
+	'M': TileMetalWall,
+	'P': TilePillar,
+	'S': TileStairs,
+	'D': TileDoor,
+	'^': TileCeiling,
+}
+
+const layoutSymbolPool = "abcdefghijklmnopqrstuvwxyzACEFGHIJKLNOQRTUVXYZ0123456789!$%&*+-/<>?@"
+
+func (s LayoutSymbol) String() string {
+	var fields []string
+	if s.Entity != nil {
+		e := s.Entity
+		fields = append(fields, e.Type)
+		if e.Sprite != "" {
+			fields = append(fields, e.Sprite)
+		}
+		if e.Direction != "" {
+			fields = append(fields, "direction="+e.Direction)
+		}
+		if e.Health != nil {
+			fields = append(fields, "health="+strconv.Itoa(*e.Health))
+		}
+		if e.MoveSpeed != 0 {
+			fields = append(fields, "move_speed="+formatFloat(e.MoveSpeed))
+		}
+		if e.MoveTimer != 0 {
+			fields = append(fields, "move_timer="+formatFloat(e.MoveTimer))
+		}
+		if e.Key != "" {
+			fields = append(fields, "key="+e.Key)
+		}
+		if e.Path != nil {
+			fields = append(fields, "path="+formatPath(e.Path))
+		}
+		if e.On {
+			fields = append(fields, "on=true")
+		}
+		return strings.Join(fields, " ")
+	}
+
+	fields = append(fields, s.Tile.Type)
+	if s.Tile.Solid != nil {
+		fields = append(fields, "solid="+strconv.FormatBool(*s.Tile.Solid))
+	}
+	if s.Tile.Height != nil {
+		fields = append(fields, "height="+formatFloat(*s.Tile.Height))
+	}
+	return strings.Join(fields, " ")
+}
+
+func formatFloat(f float32) string {
+	return strconv.FormatFloat(float64(f), 'g', -1, 32)
+}
+
+func parseLayoutSymbol(fields []string) (LayoutSymbol, error) {
+	var symbol LayoutSymbol
+
+	if entityType, ok := ParseEntityType(fields[0]); ok {
+		if entityType == EntityPlayer {
+			return symbol, fmt.Errorf("the player cannot be placed in a layout")
+		}
+		entity := &LevelEntity{Type: fields[0]}
+		rest := fields[1:]
+		if names := spriteNamesFor(entityType); names != nil {
+			if len(rest) == 0 || strings.Contains(rest[0], "=") {
+				return symbol, fmt.Errorf("%s needs a sprite (one of %s)", fields[0], strings.Join(names, ", "))
+			}
+			if _, ok := ParseSpriteName(entityType, rest[0]); !ok {
+				return symbol, fmt.Errorf("unknown %s sprite %q (want one of %s)", fields[0], rest[0], strings.Join(names, ", "))
+			}
+			entity.Sprite = rest[0]
+			rest = rest[1:]
+		}
+
+		for _, option := range rest {
+			key, value, _ := strings.Cut(option, "=")
+			var err error
+			switch key {
+			case "direction":
+				if _, ok := ParseDirection(value); !ok {
+					err = fmt.Errorf("unknown direction %q", value)
+				}
+				entity.Direction = value
+			case "health":
+				var health int
+				health, err = strconv.Atoi(value)
+				entity.Health = &health
+			case "move_speed":
+				entity.MoveSpeed, err = parseFloat32(value)
+			case "move_timer":
+				entity.MoveTimer, err = parseFloat32(value)
+			case "key":
+				if entityType != EntityItem || entity.Sprite != "key" {
+					err = fmt.Errorf("only keys can have a key name")
+				}
+				entity.Key = value
+			case "path":
+				if entityType != EntityPlatform {
+					err = fmt.Errorf("only platforms can have a path")
+				} else {
+					entity.Path, err = parsePath(value)
+				}
+			case "on":
+				if entityType != EntitySwitch {
+					err = fmt.Errorf("only switches can be on")
+				} else {
+					entity.On, err = strconv.ParseBool(value)
+				}
+			default:
+				err = fmt.Errorf("unknown entity option %q", option)
+			}
+			if err != nil {
+				return symbol, err
+			}
+		}
+
+		symbol.Entity = entity
+		symbol.Tile.Type = tileTypeNames[TileEmpty]
+		return symbol, nil
+	}
+
+	if _, ok := ParseTileType(fields[0]); !ok {
+		return symbol, fmt.Errorf("unknown tile type or entity %q", fields[0])
+	}
+	symbol.Tile.Type = fields[0]
+
+	for _, option := range fields[1:] {
+		key, value, _ := strings.Cut(option, "=")
+		switch key {
+		case "solid":
+			solid, err := strconv.ParseBool(value)
+			if err != nil {
+				return symbol, err
+			}
+			symbol.Tile.Solid = &solid
+		case "height":
+			height, err := parseFloat32(value)
+			if err != nil {
+				return symbol, err
+			}
+			symbol.Tile.Height = &height
+		default:
+			return symbol, fmt.Errorf("unknown tile option %q", option)
+		}
+	}
+
+	return symbol, nil
+}
+
+// place puts the symbol's tile or entity into the world at a grid cell.
+// Entities get the next free index as their ID.
+func (s LayoutSymbol) place(world *World3D, x, y, z int) {
+	if s.Entity != nil {
+		entityDef := *s.Entity
+		entityDef.At = []float32{float32(x), float32(y), float32(z)}
+		world.Entities = append(world.Entities, entityDef.build(len(world.Entities)))
+		return
+	}
+
+	tileType, _ := ParseTileType(s.Tile.Type)
+	if tileType == TileEmpty {
+		return
+	}
+	tile := NewTile(tileType, x, y, z)
+	if s.Tile.Solid != nil {
+		tile.Solid = *s.Tile.Solid
+	}
+	if s.Tile.Height != nil {
+		tile.Height = *s.Tile.Height
+	}
+	world.Tiles[x][y][z] = tile
+}
+
+func makeTiles(width, height, depth int) [][][]Tile3D {
+	tiles := make([][][]Tile3D, width)
+	for x := range tiles {
+		tiles[x] = make([][]Tile3D, height)
+		for y := range tiles[x] {
+			tiles[x][y] = make([]Tile3D, depth)
+		}
+	}
+	return tiles
+}
+
+func defaultLayoutChar(t TileType) rune {
+	for ch, tileType := range defaultLayoutLegend {
+		if tileType == t {
+			return ch
+		}
+	}
+	return 0
+}
+
+// parsePath reads waypoints written as "x,y,z;x,y,z;...".
+func parsePath(s string) ([][]float32, error) {
+	var path [][]float32
+	for _, waypoint := range strings.Split(s, ";") {
+		var p []float32
+		for _, part := range strings.Split(waypoint, ",") {
+			f, err := parseFloat32(strings.TrimSpace(part))
+			if err != nil {
+				return nil, fmt.Errorf("path needs waypoints like \"3,1,2;3,5,2\"")
+			}
+			p = append(p, f)
+		}
+		if len(p) != 3 {
+			return nil, fmt.Errorf("path waypoint %q is not x,y,z", waypoint)
+		}
+		path = append(path, p)
+	}
+	return path, nil
+}
+
+func formatPath(path [][]float32) string {
+	waypoints := make([]string, len(path))
+	for i, p := range path {
+		waypoints[i] = formatFloat(p[0]) + "," + formatFloat(p[1]) + "," + formatFloat(p[2])
+	}
+	return strings.Join(waypoints, ";")
+}
+
+func parseFloat32(s string) (float32, error) {
+	f, err := strconv.ParseFloat(s, 32)
+	return float32(f), err
+}
+
+type layoutLayer struct {
+	y        int
+	line     int
+	rows     []string
+	rowLines []int
+}
+
+// ParseLayout reads a layout file into a World3D. Entity IDs are numbered
+// from zero in the order the entities appear.
+func ParseLayout(file string, r io.Reader) (*World3D, error) {
+	var errs LevelErrors
+	addf := func(line int, format string, args ...interface{}) {
+		errs = append(errs, LevelError{File: file, Line: line, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	legend := make(map[rune]LayoutSymbol)
+	for ch, t := range defaultLayoutLegend {
+		legend[ch] = LayoutSymbol{Tile: LevelTile{Type: tileTypeNames[t]}}
+	}
+
+	var layers []*layoutLayer
+	var current *layoutLayer
+	inLegend := false
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+
+		if strings.HasPrefix(line, "//") {
+			continue
+		}
+		if line == "" {
+			current = nil
+			inLegend = false
+			continue
+		}
+
+		if current != nil {
+			current.rows = append(current.rows, line)
+			current.rowLines = append(current.rowLines, lineNo)
+			continue
+		}
+
+		if inLegend {
+			symbols := []rune(line)
+			fields := strings.Fields(string(symbols[1:]))
+			if len(fields) == 0 || !strings.HasPrefix(string(symbols[1:]), " ") {
+				addf(lineNo, "legend entries look like \"<char> <tile or entity>\"")
+				continue
+			}
+			symbol, err := parseLayoutSymbol(fields)
+			if err != nil {
+				addf(lineNo, "%v", err)
+				continue
+			}
+			legend[symbols[0]] = symbol
+			continue
+		}
+
+		fields := strings.Fields(line)
+		switch {
+		case fields[0] == "legend" && len(fields) == 1:
+			inLegend = true
+		case fields[0] == "layer" && len(fields) == 2:
+			y, err := strconv.Atoi(fields[1])
+			if err != nil || y < 0 {
+				addf(lineNo, "layer needs a non-negative Y level, got %q", fields[1])
+				continue
+			}
+			for _, layer := range layers {
+				if layer.y == y {
+					addf(lineNo, "layer %d is already defined on line %d", y, layer.line)
+				}
+			}
+			current = &layoutLayer{y: y, line: lineNo}
+			layers = append(layers, current)
+		default:
+			addf(lineNo, "expected \"legend\" or \"layer <y>\", got %q", line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(layers) == 0 && len(errs) == 0 {
+		addf(0, "layout has no layers")
+	}
+
+	world := &World3D{}
+	for _, layer := range layers {
+		if len(layer.rows) == 0 {
+			addf(layer.line, "layer %d has no rows", layer.y)
+			continue
+		}
+		world.Height = max(world.Height, layer.y+1)
+		if world.Depth == 0 {
+			world.Width = len([]rune(layer.rows[0]))
+			world.Depth = len(layer.rows)
+		}
+		if len(layer.rows) != world.Depth {
+			addf(layer.line, "layer %d has %d rows, expected %d", layer.y, len(layer.rows), world.Depth)
+		}
+		for i, row := range layer.rows {
+			if n := len([]rune(row)); n != world.Width {
+				addf(layer.rowLines[i], "row is %d characters wide, expected %d", n, world.Width)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	world.Tiles = makeTiles(world.Width, world.Height, world.Depth)
+
+	sort.Slice(layers, func(i, j int) bool { return layers[i].y < layers[j].y })
+
+	for _, layer := range layers {
+		for z, row := range layer.rows {
+			for x, ch := range []rune(row) {
+				symbol, ok := legend[ch]
+				if !ok {
+					addf(layer.rowLines[z], "character %q at column %d is not in the legend", ch, x+1)
+					continue
+				}
+
+				symbol.place(world, x, layer.y, z)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return world, nil
+}
+
+// WriteLayout writes the tiles and entities of a world in the layout format,
+// with a legend covering exactly the characters it uses. The player is left
+// out. Entities must stand on an empty grid cell, be numbered in the order
+// ParseLayout meets them, and have nothing set that the legend cannot write;
+// anything else is an error rather than being left out of the layout.
+func WriteLayout(w io.Writer, world *World3D) error {
+	var order []string
+	symbols := make(map[string]rune)
+	used := make(map[rune]bool)
+
+	// The pool leaves out the default tile characters, so they only ever
+	// stand for their own tile and a layout still reads the same to someone
+	// who skips the legend.
+	assign := func(symbol LayoutSymbol, preferred rune) rune {
+		spec := symbol.String()
+		if ch, ok := symbols[spec]; ok {
+			return ch
+		}
+		ch := rune(0)
+		if preferred != 0 && !used[preferred] {
+			ch = preferred
+		}
+		for _, p := range layoutSymbolPool {
+			if ch != 0 {
+				break
+			}
+			if !used[p] {
+				ch = p
+			}
+		}
+		if ch == 0 {
+			return 0
+		}
+		used[ch] = true
+		symbols[spec] = ch
+		order = append(order, spec)
+		return ch
+	}
+
+	grid := make([][][]rune, world.Height)
+	for y := range grid {
+		grid[y] = make([][]rune, world.Depth)
+		for z := range grid[y] {
+			grid[y][z] = make([]rune, world.Width)
+			for x := range grid[y][z] {
+				tile := world.Tiles[x][y][z]
+				symbol := LayoutSymbol{Tile: LevelTile{Type: tile.Type.String()}}
+				if tile.Type != TileEmpty {
+					if tile.Solid != IsTileSolidByDefault(tile.Type) {
+						solid := tile.Solid
+						symbol.Tile.Solid = &solid
+					}
+					if tile.Height != 1.0 {
+						height := tile.Height
+						symbol.Tile.Height = &height
+					}
+				}
+
+				preferred := rune(0)
+				if symbol.Tile.Solid == nil && symbol.Tile.Height == nil {
+					preferred = defaultLayoutChar(tile.Type)
+				}
+				ch := assign(symbol, preferred)
+				if ch == 0 {
+					return fmt.Errorf("too many distinct tiles for a layout")
+				}
+				grid[y][z][x] = ch
+			}
+		}
+	}
+
+	ids := make(map[[3]int]int)
+	for _, entity := range world.Entities {
+		if entity.Type == EntityPlayer {
+			continue
+		}
+
+		x, y, z := int(entity.Position.X), int(entity.Position.Y), int(entity.Position.Z)
+		if float32(x) != entity.Position.X || float32(y) != entity.Position.Y || float32(z) != entity.Position.Z ||
+			x < 0 || x >= world.Width || y < 0 || y >= world.Height || z < 0 || z >= world.Depth {
+			return fmt.Errorf("entity %d at (%g,%g,%g) is not on a grid cell", entity.ID, entity.Position.X, entity.Position.Y, entity.Position.Z)
+		}
+		if world.Tiles[x][y][z].Type != TileEmpty {
+			return fmt.Errorf("entity %d at (%d,%d,%d) shares its cell with a %s tile", entity.ID, x, y, z, world.Tiles[x][y][z].Type)
+		}
+		if grid[y][z][x] != '.' {
+			return fmt.Errorf("entity %d at (%d,%d,%d) shares its cell with another entity", entity.ID, x, y, z)
+		}
+
+		def, err := levelEntityFrom(entity)
+		if err != nil {
+			return err
+		}
+		symbol := LayoutSymbol{Entity: def}
+		preferred := rune(0)
+		if sprite := symbol.Entity.Sprite; sprite != "" {
+			preferred = rune(sprite[0])
+			if entity.Type == EntityEnemy {
+				preferred = rune(strings.ToUpper(sprite)[0])
+			}
+			if _, reserved := defaultLayoutLegend[preferred]; reserved {
+				preferred = 0
+			}
+		}
+		ch := assign(symbol, preferred)
+		if ch == 0 {
+			return fmt.Errorf("too many distinct entities for a layout")
+		}
+		grid[y][z][x] = ch
+		ids[[3]int{x, y, z}] = entity.ID
+	}
+
+	// ParseLayout numbers entities as it meets them, a layer at a time, row
+	// by row.
+	next := 0
+	for y := range grid {
+		for z := range grid[y] {
+			for x := range grid[y][z] {
+				id, ok := ids[[3]int{x, y, z}]
+				if !ok {
+					continue
+				}
+				if id != next {
+					return fmt.Errorf("entity %d at (%d,%d,%d) would be numbered %d when the layout is read", id, x, y, z, next)
+				}
+				next++
+			}
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "legend")
+	for _, spec := range order {
+		fmt.Fprintf(bw, "%c %s\n", symbols[spec], spec)
+	}
+	for y := range grid {
+		fmt.Fprintf(bw, "\nlayer %d\n", y)
+		for z := range grid[y] {
+			fmt.Fprintln(bw, string(grid[y][z]))
+		}
+	}
+	return bw.Flush()
+}
+
+// levelEntityFrom describes an entity the way a layout legend would, leaving
+// out anything that matches the defaults NewEntity and LevelEntity.build
+// already apply. It is an error for the entity to have any level file field
+// set that the legend has no option for.
+func levelEntityFrom(entity GameEntity) (*LevelEntity, error) {
+	defaults := NewEntity(entity.ID, entity.Type, entity.Position, entity.SpriteID)
+	var lost []string
+	check := func(field string, set bool) {
+		if set {
+			lost = append(lost, field)
+		}
+	}
+
+	def := &LevelEntity{Type: entityTypeNames[entity.Type]}
+	if names := spriteNamesFor(entity.Type); entity.SpriteID >= 0 && entity.SpriteID < len(names) {
+		def.Sprite = names[entity.SpriteID]
+	} else {
+		check("sprite_id", names != nil || entity.SpriteID != 0)
+	}
+	if entity.Direction != DirDown {
+		def.Direction = directionNames[entity.Direction]
+	}
+
+	// A legend's health is both the health and the most it can be.
+	if entity.Health != defaults.Health || entity.MaxHealth != defaults.MaxHealth {
+		health := entity.Health
+		def.Health = &health
+	}
+	check("max_health", entity.MaxHealth != entity.Health)
+	def.MoveSpeed = entity.MoveSpeed
+	def.MoveTimer = entity.MoveTimer
+	def.Key = entity.Key
+	def.Path = pathToLevel(entity.Path)
+	def.On = entity.On
+
+	check("active", !entity.Active)
+	check("color", entity.Color != defaults.Color)
+	check("bounds", entity.Bounds != defaults.Bounds)
+	check("frame", entity.Frame != 0)
+	check("anim_speed", entity.AnimSpeed != 0)
+	check("target", entity.TargetPosition != defaults.TargetPosition)
+	check("moving", entity.IsMoving)
+	check("velocity_y", entity.VelocityY != 0)
+	check("path_index", entity.PathIndex != 0)
+	check("path_progress", entity.PathProgress != 0)
+	check("script", entity.Script != "")
+	check("dialogue", entity.Dialogue != "")
+	if len(lost) > 0 {
+		return nil, fmt.Errorf("entity %d at %s has %s set, which a layout cannot hold", entity.ID, formatPoint(entity.Position), strings.Join(lost, ", "))
+	}
+	return def, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestWriteLayout writes each sample layout back out and reads it again,
+// and checks that the room comes back the same and that writing it again
+// gives the same text.
+func TestWriteLayout(t *testing.T) {
+	for _, name := range []string{"gallery.txt", "library.txt"} {
+		path := "game_assets/levels/rooms/" + name
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		world, err := ParseLayout(path, bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var written bytes.Buffer
+		if err := WriteLayout(&written, world); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		again, err := ParseLayout(name, bytes.NewReader(written.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", name, err, written.String())
+		}
+		if !reflect.DeepEqual(world, again) {
+			t.Errorf("%s: room differs after writing it as\n%s", name, written.String())
+		}
+
+		var rewritten bytes.Buffer
+		if err := WriteLayout(&rewritten, again); err != nil {
+			t.Fatal(err)
+		}
+		if rewritten.String() != written.String() {
+			t.Errorf("%s: written as\n%s\nthen as\n%s", name, written.String(), rewritten.String())
+		}
+	}
+}
+
+// TestWriteLayoutErrors checks that an entity with something the legend
+// cannot write is an error rather than being written without it.
+func TestWriteLayoutErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(entity *GameEntity)
+		want   string
+	}{
+		{"picked up", func(e *GameEntity) { e.Active = false }, "active"},
+		{"hurt", func(e *GameEntity) { e.Health = 1 }, "max_health"},
+		{"script", func(e *GameEntity) { e.Script = "orc.script" }, "script"},
+		{"dialogue", func(e *GameEntity) { e.Dialogue = "orc.dialogue" }, "dialogue"},
+		{"colour", func(e *GameEntity) { e.Color.G = 0 }, "color"},
+		{"bounds", func(e *GameEntity) { e.Bounds.Max.Y += 1 }, "bounds"},
+		{"numbered out of order", func(e *GameEntity) { e.ID = 7 }, "would be numbered 0"},
+	}
+
+	for _, test := range tests {
+		world := &World3D{Width: 3, Height: 2, Depth: 3, Tiles: makeTiles(3, 2, 3)}
+		orc := NewEntity(0, EntityEnemy, Point3D{X: 1, Y: 1, Z: 1}, 1)
+		test.change(&orc)
+		world.Entities = []GameEntity{orc}
+
+		var written bytes.Buffer
+		err := WriteLayout(&written, world)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got error %v, want one saying %q", test.name, err, test.want)
+		}
+	}
+
+	world := &World3D{Width: 3, Height: 2, Depth: 3, Tiles: makeTiles(3, 2, 3)}
+	orc := NewEntity(0, EntityEnemy, Point3D{X: 1, Y: 1, Z: 1}, 1)
+	orc.Health, orc.MaxHealth = 5, 5
+	world.Entities = []GameEntity{orc}
+	var written bytes.Buffer
+	if err := WriteLayout(&written, world); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(written.String(), "health=5") {
+		t.Errorf("health left out of\n%s", written.String())
+	}
+}
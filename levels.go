@@ -0,0 +1,1195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// Level files describe a whole mansion on disk. The format is documented in
+// docs/level_format.md.
+
+const LevelFormatVersion = 1
+
+type LevelFile struct {
+	Version      int               `json:"version"`
+	Start        LevelStart        `json:"start"`
+	VoxelPalette map[string]string `json:"voxel_palette,omitempty"`
+	Script       string            `json:"script,omitempty"`
+	Objectives   []LevelObjective  `json:"objectives,omitempty"`
+	Rooms        []LevelRoom       `json:"rooms"`
+}
+
+type LevelStart struct {
+	Room     int       `json:"room"`
+	Position []float32 `json:"position"`
+}
+
+type LevelRoom struct {
+	ID          int               `json:"id"`
+	Name        string            `json:"name"`
+	Size        []int             `json:"size"`
+	Floor       string            `json:"floor,omitempty"`
+	Layout      string            `json:"layout,omitempty"`
+	Model       int               `json:"model,omitempty"`
+	Layers      []LevelLayer      `json:"layers,omitempty"`
+	Connections []LevelConnection `json:"connections,omitempty"`
+	Entities    []LevelEntity     `json:"entities,omitempty"`
+
+	Storey       int  `json:"storey,omitempty"`
+	ResetEnemies bool `json:"reset_enemies,omitempty"`
+
+	Targets []LevelTarget `json:"targets,omitempty"`
+	Wires   []LevelWire   `json:"wires,omitempty"`
+	Script  string        `json:"script,omitempty"`
+}
+
+type LevelLayer struct {
+	Y     int         `json:"y"`
+	Tiles []LevelTile `json:"tiles"`
+}
+
+type LevelTile struct {
+	Type     string    `json:"type"`
+	At       []int     `json:"at,omitempty"`
+	From     []int     `json:"from,omitempty"`
+	To       []int     `json:"to,omitempty"`
+	Solid    *bool     `json:"solid,omitempty"`
+	Height   *float32  `json:"height,omitempty"`
+	Position []float32 `json:"position,omitempty"`
+}
+
+type LevelConnection struct {
+	At          []float32 `json:"at"`
+	ToRoom      int       `json:"to_room"`
+	To          []float32 `json:"to"`
+	Direction   string    `json:"direction"`
+	RequiresKey bool      `json:"requires_key,omitempty"`
+	Key         string    `json:"key,omitempty"`
+	ConsumeKey  bool      `json:"consume_key,omitempty"`
+	Active      *bool     `json:"active,omitempty"`
+}
+
+type LevelEntity struct {
+	ID        *int         `json:"id,omitempty"`
+	Type      string       `json:"type"`
+	Sprite    string       `json:"sprite,omitempty"`
+	SpriteID  *int         `json:"sprite_id,omitempty"`
+	At        []float32    `json:"at"`
+	Direction string       `json:"direction,omitempty"`
+	Health    *int         `json:"health,omitempty"`
+	MaxHealth *int         `json:"max_health,omitempty"`
+	MoveSpeed float32      `json:"move_speed,omitempty"`
+	MoveTimer float32      `json:"move_timer,omitempty"`
+	Active    *bool        `json:"active,omitempty"`
+	Color     []int        `json:"color,omitempty"`
+	Bounds    *LevelBounds `json:"bounds,omitempty"`
+	Frame     int          `json:"frame,omitempty"`
+	AnimSpeed float32      `json:"anim_speed,omitempty"`
+	Target    []float32    `json:"target,omitempty"`
+	Moving    bool         `json:"moving,omitempty"`
+	VelocityY float32      `json:"velocity_y,omitempty"`
+	Key       string       `json:"key,omitempty"`
+
+	Path         [][]float32 `json:"path,omitempty"`
+	PathIndex    int         `json:"path_index,omitempty"`
+	PathProgress float32     `json:"path_progress,omitempty"`
+
+	On       bool   `json:"on,omitempty"`
+	Script   string `json:"script,omitempty"`
+	Dialogue string `json:"dialogue,omitempty"`
+}
+
+// LevelTarget names one thing in a room for wires to act on. Exactly one of
+// Door, Connection, Tiles and Entity is given.
+type LevelTarget struct {
+	ID         string            `json:"id"`
+	Door       []float32         `json:"door,omitempty"`
+	Connection []float32         `json:"connection,omitempty"`
+	Tiles      *LevelTargetTiles `json:"tiles,omitempty"`
+	Entity     *int              `json:"entity,omitempty"`
+}
+
+// LevelTargetTiles is a box of tiles, given by opposite corners as
+// [x, y, z], that a wire turns to On and back to Off. Off defaults to the
+// tile at From when the level is built.
+type LevelTargetTiles struct {
+	From []int  `json:"from"`
+	To   []int  `json:"to"`
+	On   string `json:"on"`
+	Off  string `json:"off,omitempty"`
+}
+
+type LevelWire struct {
+	Sources []int   `json:"sources"`
+	Logic   string  `json:"logic,omitempty"`
+	Time    float32 `json:"time,omitempty"`
+	Action  string  `json:"action"`
+	Target  string  `json:"target"`
+
+	Input   bool    `json:"input,omitempty"`
+	On      bool    `json:"on,omitempty"`
+	Applied bool    `json:"applied,omitempty"`
+	Timer   float32 `json:"timer,omitempty"`
+}
+
+// LevelObjective is something the player is asked to do. Exactly one of
+// Collect, Kill, Reach and Var is given. Progress is how far the player has
+// got, which saves fill in.
+type LevelObjective struct {
+	ID       string `json:"id"`
+	Text     string `json:"text"`
+	Collect  string `json:"collect,omitempty"`
+	Kill     string `json:"kill,omitempty"`
+	Reach    *int   `json:"reach,omitempty"`
+	Var      string `json:"var,omitempty"`
+	Count    int    `json:"count,omitempty"`
+	Optional bool   `json:"optional,omitempty"`
+
+	Progress int `json:"progress,omitempty"`
+}
+
+type LevelBounds struct {
+	Min []float32 `json:"min"`
+	Max []float32 `json:"max"`
+}
+
+type LevelError struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e LevelError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+	}
+	return fmt.Sprintf("%s: %s", e.File, e.Msg)
+}
+
+type LevelErrors []LevelError
+
+func (errs LevelErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, e := range errs {
+		lines[i] = e.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+var tileTypeNames = map[TileType]string{
+	TileEmpty:      "empty",
+	TileStoneFloor: "floor_stone",
+	TileWoodFloor:  "floor_wood",
+	TileGrassFloor: "floor_grass",
+	TileSandFloor:  "floor_sand",
+	TileStoneWall:  "wall_stone",
+	TileBrickWall:  "wall_brick",
+	TileWoodWall:   "wall_wood",
+	TileMetalWall:  "wall_metal",
+	TilePillar:     "pillar",
+	TileStairs:     "stairs",
+	TileDoor:       "door",
+	TileCeiling:    "ceiling",
+}
+
+var entityTypeNames = map[EntityType]string{
+	EntityPlayer:   "player",
+	EntityItem:     "item",
+	EntityEnemy:    "enemy",
+	EntityNPC:      "npc",
+	EntityEffect:   "effect",
+	EntityBlock:    "block",
+	EntityPlatform: "platform",
+	EntitySwitch:   "switch",
+}
+
+var directionNames = map[Direction]string{
+	DirDown:  "down",
+	DirLeft:  "left",
+	DirUp:    "up",
+	DirRight: "right",
+}
+
+var itemSpriteNames = []string{"key", "gem", "potion", "sword", "shield", "food"}
+var enemySpriteNames = []string{"goblin", "orc", "troll", "skeleton"}
+var blockSpriteNames = []string{"stone", "brick", "wood", "metal"}
+var platformSpriteNames = []string{"stone", "wood", "grass", "sand"}
+
+// keySpriteID is the item sprite that opens locked doors.
+const keySpriteID = 0
+
+func (t TileType) String() string {
+	if name, ok := tileTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("tile(%d)", int(t))
+}
+
+func ParseTileType(name string) (TileType, bool) {
+	for t, n := range tileTypeNames {
+		if n == name {
+			return t, true
+		}
+	}
+	return TileEmpty, false
+}
+
+func ParseEntityType(name string) (EntityType, bool) {
+	for t, n := range entityTypeNames {
+		if n == name {
+			return t, true
+		}
+	}
+	return EntityPlayer, false
+}
+
+func ParseDirection(name string) (Direction, bool) {
+	for d, n := range directionNames {
+		if n == name {
+			return d, true
+		}
+	}
+	return DirDown, false
+}
+
+func spriteNamesFor(entityType EntityType) []string {
+	switch entityType {
+	case EntityItem:
+		return itemSpriteNames
+	case EntityEnemy:
+		return enemySpriteNames
+	case EntityBlock:
+		return blockSpriteNames
+	case EntityPlatform:
+		return platformSpriteNames
+	case EntitySwitch:
+		return switchSpriteNames
+	}
+	return nil
+}
+
+func ParseSpriteName(entityType EntityType, name string) (int, bool) {
+	for i, n := range spriteNamesFor(entityType) {
+		if n == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func IsTileSolidByDefault(t TileType) bool {
+	switch t {
+	case TileStoneWall, TileBrickWall, TileWoodWall, TileMetalWall, TilePillar:
+		return true
+	}
+	return false
+}
+
+func NewTile(t TileType, x, y, z int) Tile3D {
+	return Tile3D{
+		Type:     t,
+		Position: Point3D{X: float32(x), Y: float32(y), Z: float32(z)},
+		Solid:    IsTileSolidByDefault(t),
+		Height:   1.0,
+	}
+}
+
+func NewEntity(id int, entityType EntityType, pos Point3D, spriteID int) GameEntity {
+	half := float32(0.4)
+	health := 3
+	if entityType == EntityItem {
+		half = 0.3
+		health = 1
+	}
+
+	return GameEntity{
+		ID:        id,
+		Type:      entityType,
+		Position:  pos,
+		Direction: DirDown,
+		Bounds: BoundingBox3D{
+			Min: Point3D{X: pos.X - half, Y: pos.Y - half, Z: pos.Z - half},
+			Max: Point3D{X: pos.X + half, Y: pos.Y + half, Z: pos.Z + half},
+		},
+		SpriteID:       spriteID,
+		Active:         true,
+		Color:          rl.White,
+		Health:         health,
+		MaxHealth:      health,
+		TargetPosition: pos,
+	}
+}
+
+// Level keeps the decoded file together with the source line of every JSON
+// value so that problems found after decoding can still point at a line.
+type Level struct {
+	File    string
+	Data    LevelFile
+	Layouts map[int]*World3D
+	Scripts map[string]*Script
+	lines   map[string]int
+}
+
+func ParseLevel(file string, data []byte) (*Level, error) {
+	lines, err := indexJSONLines(data)
+	if err != nil {
+		return nil, jsonLevelError(file, data, err)
+	}
+
+	level := &Level{File: file, lines: lines}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&level.Data); err != nil {
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			field = strings.Trim(field, `"`)
+			return nil, LevelErrors{{File: file, Line: level.lineOfKey(field), Msg: fmt.Sprintf("unknown field %q", field)}}
+		}
+		return nil, jsonLevelError(file, data, err)
+	}
+
+	if level.Data.Version != LevelFormatVersion {
+		return nil, LevelErrors{level.errorf("version", "unsupported level version %d (want %d)", level.Data.Version, LevelFormatVersion)}
+	}
+
+	if errs := level.loadLayouts(); len(errs) > 0 {
+		return nil, errs
+	}
+	if errs := level.loadScripts(); len(errs) > 0 {
+		return nil, errs
+	}
+
+	return level, nil
+}
+
+// loadLayouts reads the layout files rooms refer to, relative to the level
+// file. A room without a size takes the size of its layout.
+func (level *Level) loadLayouts() LevelErrors {
+	var errs LevelErrors
+	level.Layouts = make(map[int]*World3D)
+
+	palette, err := ParseVoxPalette(level.Data.VoxelPalette)
+	if err != nil {
+		return LevelErrors{level.errorf("voxel_palette", "%v", err)}
+	}
+	voxFiles := make(map[string][]VoxModel)
+
+	for i := range level.Data.Rooms {
+		def := &level.Data.Rooms[i]
+		if def.Layout == "" {
+			continue
+		}
+
+		path := filepath.Join(filepath.Dir(level.File), def.Layout)
+		var world *World3D
+		if strings.ToLower(filepath.Ext(path)) == ".vox" {
+			world, err = level.voxLayout(path, def.Model, palette, voxFiles)
+		} else {
+			world, err = readLayout(path)
+		}
+		if err != nil {
+			var layoutErrs LevelErrors
+			if errors.As(err, &layoutErrs) {
+				errs = append(errs, layoutErrs...)
+			} else {
+				errs = append(errs, level.errorf(fmt.Sprintf("rooms[%d].layout", i), "%v", err))
+			}
+			continue
+		}
+
+		if def.Size == nil {
+			def.Size = []int{world.Width, world.Height, world.Depth}
+		} else if len(def.Size) != 3 || def.Size[0] != world.Width || def.Size[1] != world.Height || def.Size[2] != world.Depth {
+			errs = append(errs, level.errorf(fmt.Sprintf("rooms[%d].size", i), "room %d: size %v does not match layout %s (%dx%dx%d)",
+				def.ID, def.Size, def.Layout, world.Width, world.Height, world.Depth))
+			continue
+		}
+		level.Layouts[i] = world
+	}
+
+	return errs
+}
+
+func (level *Level) voxLayout(path string, model int, palette VoxPalette, cache map[string][]VoxModel) (*World3D, error) {
+	models, ok := cache[path]
+	if !ok {
+		var err error
+		models, err = readVoxModels(path)
+		if err != nil {
+			return nil, err
+		}
+		cache[path] = models
+	}
+
+	if model < 0 || model >= len(models) {
+		return nil, fmt.Errorf("%s has %d models, there is no model %d", path, len(models), model)
+	}
+	return models[model].World(palette)
+}
+
+func readLayout(path string) (*World3D, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseLayout(path, f)
+}
+
+func (fg *FilmationGame) LoadLevel(path string) error {
+	if isTiledPath(path) {
+		return fg.LoadTiled(path)
+	}
+	if strings.ToLower(filepath.Ext(path)) == ".vox" {
+		return fg.LoadVox(path, DefaultVoxPalette())
+	}
+
+	fmt.Printf("Loading level: %s\n", path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	level, err := ParseLevel(path, data)
+	if err != nil {
+		return err
+	}
+
+	if err := fg.BuildLevel(level); err != nil {
+		return err
+	}
+	fg.FireHook(HookEnterRoom, nil)
+	return nil
+}
+
+func (fg *FilmationGame) BuildLevel(level *Level) error {
+	if errs := level.Validate(); len(errs) > 0 {
+		return errs
+	}
+
+	fg.InitRoomSystem()
+	fg.Scripts = level.Scripts
+	fg.LevelScript = level.scriptPath(level.Data.Script)
+	fg.ScriptVars = nil
+
+	for i, def := range level.Data.Rooms {
+		room := fg.CreateRoom(def.ID, def.Name, def.Size[0], def.Size[1], def.Size[2])
+		room.Storey = def.Storey
+		room.ResetEnemies = def.ResetEnemies
+		room.Script = level.scriptPath(def.Script)
+		if def.Floor != "" {
+			floorType, _ := ParseTileType(def.Floor)
+			fg.BuildBasicRoom(room, floorType)
+		}
+
+		if layout := level.Layouts[i]; layout != nil {
+			for x := range layout.Tiles {
+				for y := range layout.Tiles[x] {
+					for z, tile := range layout.Tiles[x][y] {
+						if tile.Type != TileEmpty {
+							room.World.Tiles[x][y][z] = tile
+						}
+					}
+				}
+			}
+		}
+
+		for _, conn := range def.Connections {
+			direction, _ := ParseDirection(conn.Direction)
+			fg.AddRoomConnection(def.ID, conn.ToRoom, pointFromLevel(conn.At), pointFromLevel(conn.To), direction, conn.RequiresKey)
+			added := &room.Connections[len(room.Connections)-1]
+			added.Key = conn.Key
+			added.ConsumeKey = conn.ConsumeKey
+			if conn.Active != nil {
+				added.Active = *conn.Active
+			}
+		}
+
+		for _, layer := range def.Layers {
+			for _, tileDef := range layer.Tiles {
+				tileType, _ := ParseTileType(tileDef.Type)
+				fromX, fromZ, toX, toZ := tileDef.bounds()
+				for x := fromX; x <= toX; x++ {
+					for z := fromZ; z <= toZ; z++ {
+						tile := NewTile(tileType, x, layer.Y, z)
+						if tileDef.Solid != nil {
+							tile.Solid = *tileDef.Solid
+						}
+						if tileDef.Height != nil {
+							tile.Height = *tileDef.Height
+						}
+						if tileDef.Position != nil {
+							tile.Position = pointFromLevel(tileDef.Position)
+						}
+						room.World.Tiles[x][layer.Y][z] = tile
+					}
+				}
+			}
+		}
+	}
+
+	// Entities without an id, such as those from layouts, are numbered after
+	// the highest id the level gives, so that they never take one of those.
+	entityID := 0
+	for _, def := range level.Data.Rooms {
+		for _, entityDef := range def.Entities {
+			if entityDef.ID != nil {
+				entityID = max(entityID, *entityDef.ID+1)
+			}
+		}
+	}
+	for i, def := range level.Data.Rooms {
+		room := fg.Rooms.Rooms[def.ID]
+		if layout := level.Layouts[i]; layout != nil {
+			for _, entity := range layout.Entities {
+				entity.ID = entityID
+				room.World.Entities = append(room.World.Entities, entity)
+				entityID++
+			}
+		}
+		for _, entityDef := range def.Entities {
+			entity := entityDef.build(entityID)
+			entity.Script = level.scriptPath(entity.Script)
+			entity.Dialogue = level.scriptPath(entity.Dialogue)
+			room.World.Entities = append(room.World.Entities, entity)
+			if entityDef.ID == nil {
+				entityID++
+			}
+		}
+		for _, target := range def.Targets {
+			room.Targets = append(room.Targets, target.build(&room.World))
+		}
+		for _, wire := range def.Wires {
+			room.Wires = append(room.Wires, wire.build())
+		}
+	}
+
+	fg.SetupPlayerInRoom(level.Data.Start.Room, pointFromLevel(level.Data.Start.Position))
+
+	fg.Objectives = nil
+	for _, def := range level.Data.Objectives {
+		fg.Objectives = append(fg.Objectives, def.build())
+	}
+	fg.Won = false
+	fg.countObjectives()
+	fg.checkObjectives(false)
+
+	fmt.Printf("Built %d rooms from %s\n", len(fg.Rooms.Rooms), level.File)
+	return nil
+}
+
+func (def LevelEntity) build(id int) GameEntity {
+	entityType, _ := ParseEntityType(def.Type)
+	spriteID, _ := ParseSpriteName(entityType, def.Sprite)
+	if def.SpriteID != nil {
+		spriteID = *def.SpriteID
+	}
+	if def.ID != nil {
+		id = *def.ID
+	}
+
+	entity := NewEntity(id, entityType, pointFromLevel(def.At), spriteID)
+	if def.Direction != "" {
+		entity.Direction, _ = ParseDirection(def.Direction)
+	}
+	if def.Health != nil {
+		entity.Health = *def.Health
+		entity.MaxHealth = *def.Health
+	}
+	if def.MaxHealth != nil {
+		entity.MaxHealth = *def.MaxHealth
+	}
+	entity.MoveSpeed = def.MoveSpeed
+	entity.MoveTimer = def.MoveTimer
+	if def.Active != nil {
+		entity.Active = *def.Active
+	}
+	if def.Color != nil {
+		entity.Color = rl.Color{R: uint8(def.Color[0]), G: uint8(def.Color[1]), B: uint8(def.Color[2]), A: uint8(def.Color[3])}
+	}
+	if def.Bounds != nil {
+		entity.Bounds = BoundingBox3D{Min: pointFromLevel(def.Bounds.Min), Max: pointFromLevel(def.Bounds.Max)}
+	}
+	entity.Frame = def.Frame
+	entity.AnimSpeed = def.AnimSpeed
+	if def.Target != nil {
+		entity.TargetPosition = pointFromLevel(def.Target)
+	}
+	entity.IsMoving = def.Moving
+	entity.VelocityY = def.VelocityY
+	entity.Key = def.Key
+	for _, p := range def.Path {
+		entity.Path = append(entity.Path, pointFromLevel(p))
+	}
+	entity.PathIndex = def.PathIndex
+	entity.PathProgress = def.PathProgress
+	entity.On = def.On
+	entity.Script = def.Script
+	entity.Dialogue = def.Dialogue
+	return entity
+}
+
+func (def LevelTarget) build(world *World3D) WireTarget {
+	target := WireTarget{ID: def.ID}
+	switch {
+	case def.Door != nil:
+		target.Kind = TargetDoor
+		target.At = pointFromLevel(def.Door)
+	case def.Connection != nil:
+		target.Kind = TargetConnection
+		target.At = pointFromLevel(def.Connection)
+	case def.Tiles != nil:
+		target.Kind = TargetTiles
+		from, to := def.Tiles.From, def.Tiles.To
+		for i := range 3 {
+			target.From[i] = min(from[i], to[i])
+			target.To[i] = max(from[i], to[i])
+		}
+		target.On, _ = ParseTileType(def.Tiles.On)
+		target.Off = world.Tiles[from[0]][from[1]][from[2]].Type
+		if def.Tiles.Off != "" {
+			target.Off, _ = ParseTileType(def.Tiles.Off)
+		}
+	case def.Entity != nil:
+		target.Kind = TargetEntity
+		target.Entity = *def.Entity
+	}
+	return target
+}
+
+func (def LevelWire) build() Wire {
+	logic, _ := ParseWireLogic(def.Logic)
+	action, _ := ParseWireAction(def.Action)
+	return Wire{
+		Sources: def.Sources,
+		Logic:   logic,
+		Time:    def.Time,
+		Action:  action,
+		Target:  def.Target,
+		Input:   def.Input,
+		On:      def.On,
+		Applied: def.Applied,
+		Timer:   def.Timer,
+	}
+}
+
+func (def LevelObjective) build() Objective {
+	objective := Objective{
+		ID:       def.ID,
+		Text:     def.Text,
+		Count:    def.Count,
+		Optional: def.Optional,
+		Progress: def.Progress,
+	}
+	switch {
+	case def.Collect != "":
+		objective.Kind, objective.Target = ObjectiveCollect, def.Collect
+	case def.Kill != "":
+		objective.Kind, objective.Target = ObjectiveKill, def.Kill
+	case def.Reach != nil:
+		objective.Kind, objective.Target = ObjectiveReach, strconv.Itoa(*def.Reach)
+	case def.Var != "":
+		objective.Kind, objective.Target = ObjectiveVar, def.Var
+	}
+	return objective
+}
+
+func (def LevelTile) bounds() (fromX, fromZ, toX, toZ int) {
+	if len(def.At) == 2 {
+		return def.At[0], def.At[1], def.At[0], def.At[1]
+	}
+	fromX, toX = min(def.From[0], def.To[0]), max(def.From[0], def.To[0])
+	fromZ, toZ = min(def.From[1], def.To[1]), max(def.From[1], def.To[1])
+	return fromX, fromZ, toX, toZ
+}
+
+// countChanged counts the coordinates that differ between two points.
+func countChanged(a, b []float32) int {
+	n := 0
+	for i := range a {
+		if a[i] != b[i] {
+			n++
+		}
+	}
+	return n
+}
+
+func pointFromLevel(p []float32) Point3D {
+	return Point3D{X: p[0], Y: p[1], Z: p[2]}
+}
+
+// Validate reports every problem in the level rather than stopping at the
+// first one, so a designer can fix a whole file in one pass.
+func (level *Level) Validate() LevelErrors {
+	var errs LevelErrors
+	addf := func(path, format string, args ...interface{}) {
+		errs = append(errs, level.errorf(path, format, args...))
+	}
+
+	sizes := make(map[int][]int)
+	for i, def := range level.Data.Rooms {
+		path := fmt.Sprintf("rooms[%d]", i)
+		if _, dup := sizes[def.ID]; dup {
+			addf(path+".id", "duplicate room id %d", def.ID)
+			continue
+		}
+		if len(def.Size) != 3 || def.Size[0] <= 0 || def.Size[1] <= 0 || def.Size[2] <= 0 {
+			addf(path+".size", "room %d: size must be [width, height, depth] with positive values", def.ID)
+			continue
+		}
+		sizes[def.ID] = def.Size
+	}
+
+	if len(level.Data.Rooms) == 0 {
+		addf("rooms", "level has no rooms")
+	}
+
+	inRoom := func(size []int, x, y, z int) bool {
+		return x >= 0 && x < size[0] && y >= 0 && y < size[1] && z >= 0 && z < size[2]
+	}
+	checkPoint := func(path string, roomID int, p []float32) {
+		if len(p) != 3 {
+			addf(path, "expected [x, y, z]")
+			return
+		}
+		size := sizes[roomID]
+		if size != nil && !inRoom(size, int(p[0]), int(p[1]), int(p[2])) {
+			addf(path, "(%g,%g,%g) is outside room %d (%dx%dx%d)", p[0], p[1], p[2], roomID, size[0], size[1], size[2])
+		}
+	}
+
+	entityIDs := make(map[int]string)
+	for i, def := range level.Data.Rooms {
+		path := fmt.Sprintf("rooms[%d]", i)
+		size := sizes[def.ID]
+		if size == nil {
+			continue
+		}
+
+		if def.Floor != "" {
+			if _, ok := ParseTileType(def.Floor); !ok {
+				addf(path+".floor", "unknown tile type %q", def.Floor)
+			} else if size[1] < 2 {
+				addf(path+".floor", "room %d: a floor with walls needs a height of at least 2", def.ID)
+			}
+		}
+
+		for j, layer := range def.Layers {
+			layerPath := fmt.Sprintf("%s.layers[%d]", path, j)
+			if layer.Y < 0 || layer.Y >= size[1] {
+				addf(layerPath+".y", "layer y=%d is outside room %d (height %d)", layer.Y, def.ID, size[1])
+				continue
+			}
+			for k, tile := range layer.Tiles {
+				tilePath := fmt.Sprintf("%s.tiles[%d]", layerPath, k)
+				if _, ok := ParseTileType(tile.Type); !ok {
+					addf(tilePath+".type", "unknown tile type %q", tile.Type)
+				}
+				if tile.Position != nil && len(tile.Position) != 3 {
+					addf(tilePath+".position", "expected [x, y, z]")
+				}
+				switch {
+				case len(tile.At) == 2 && tile.From == nil && tile.To == nil:
+					if !inRoom(size, tile.At[0], layer.Y, tile.At[1]) {
+						addf(tilePath+".at", "tile (%d,%d,%d) is outside room %d (%dx%dx%d)", tile.At[0], layer.Y, tile.At[1], def.ID, size[0], size[1], size[2])
+					}
+				case tile.At == nil && len(tile.From) == 2 && len(tile.To) == 2:
+					for _, corner := range []struct {
+						name string
+						p    []int
+					}{{"from", tile.From}, {"to", tile.To}} {
+						if !inRoom(size, corner.p[0], layer.Y, corner.p[1]) {
+							addf(tilePath+"."+corner.name, "tile (%d,%d,%d) is outside room %d (%dx%dx%d)", corner.p[0], layer.Y, corner.p[1], def.ID, size[0], size[1], size[2])
+						}
+					}
+				default:
+					addf(tilePath, "tile needs either \"at\": [x, z] or \"from\"/\"to\" corners")
+				}
+			}
+		}
+
+		for j, conn := range def.Connections {
+			connPath := fmt.Sprintf("%s.connections[%d]", path, j)
+			checkPoint(connPath+".at", def.ID, conn.At)
+			if _, ok := sizes[conn.ToRoom]; !ok {
+				addf(connPath+".to_room", "unknown room id %d", conn.ToRoom)
+			} else {
+				checkPoint(connPath+".to", conn.ToRoom, conn.To)
+			}
+			if _, ok := ParseDirection(conn.Direction); !ok {
+				addf(connPath+".direction", "unknown direction %q", conn.Direction)
+			}
+		}
+
+		for j, entity := range def.Entities {
+			entityPath := fmt.Sprintf("%s.entities[%d]", path, j)
+			checkPoint(entityPath+".at", def.ID, entity.At)
+			if entity.ID != nil {
+				if other, dup := entityIDs[*entity.ID]; dup {
+					addf(entityPath+".id", "duplicate entity id %d, also given by %s", *entity.ID, other)
+				} else {
+					entityIDs[*entity.ID] = entityPath
+				}
+			}
+			entityType, ok := ParseEntityType(entity.Type)
+			if !ok || entityType == EntityPlayer {
+				addf(entityPath+".type", "unknown entity type %q", entity.Type)
+				continue
+			}
+			if names := spriteNamesFor(entityType); names != nil && entity.SpriteID == nil {
+				if _, ok := ParseSpriteName(entityType, entity.Sprite); !ok {
+					addf(entityPath+".sprite", "unknown %s sprite %q (want one of %s)", entity.Type, entity.Sprite, strings.Join(names, ", "))
+				}
+			}
+			if entity.Direction != "" {
+				if _, ok := ParseDirection(entity.Direction); !ok {
+					addf(entityPath+".direction", "unknown direction %q", entity.Direction)
+				}
+			}
+			spriteID, _ := ParseSpriteName(entityType, entity.Sprite)
+			if entity.SpriteID != nil {
+				spriteID = *entity.SpriteID
+			}
+			if entity.Key != "" && (entityType != EntityItem || spriteID != keySpriteID) {
+				addf(entityPath+".key", "only keys can have a key name")
+			}
+			if entity.Color != nil && len(entity.Color) != 4 {
+				addf(entityPath+".color", "expected [r, g, b, a]")
+			}
+			if entity.Target != nil && len(entity.Target) != 3 {
+				addf(entityPath+".target", "expected [x, y, z]")
+			}
+			if entity.Bounds != nil && (len(entity.Bounds.Min) != 3 || len(entity.Bounds.Max) != 3) {
+				addf(entityPath+".bounds", "expected \"min\" and \"max\" as [x, y, z]")
+			}
+			if entity.On && entityType != EntitySwitch {
+				addf(entityPath+".on", "only switches can be on")
+			}
+			if entity.Dialogue != "" && entityType != EntityNPC {
+				addf(entityPath+".dialogue", "only npcs can have a dialogue")
+			}
+			if entity.Path != nil {
+				if entityType != EntityPlatform {
+					addf(entityPath+".path", "only platforms can have a path")
+					continue
+				}
+				if len(entity.Path) < 2 {
+					addf(entityPath+".path", "a path needs at least two waypoints")
+					continue
+				}
+				for k, p := range entity.Path {
+					checkPoint(fmt.Sprintf("%s.path[%d]", entityPath, k), def.ID, p)
+				}
+				for k, p := range entity.Path {
+					next := entity.Path[(k+1)%len(entity.Path)]
+					if len(p) != 3 || len(next) != 3 {
+						continue
+					}
+					if axes := countChanged(p, next); axes != 1 {
+						addf(fmt.Sprintf("%s.path[%d]", entityPath, k), "waypoint (%g,%g,%g) to (%g,%g,%g) is not a straight move along one axis", p[0], p[1], p[2], next[0], next[1], next[2])
+					}
+				}
+				if entity.PathIndex < 0 || entity.PathIndex >= len(entity.Path) {
+					addf(entityPath+".path_index", "path_index %d is not a waypoint of the path", entity.PathIndex)
+				}
+			}
+		}
+
+		level.validateWiring(def, path, addf, checkPoint)
+	}
+
+	if _, ok := sizes[level.Data.Start.Room]; !ok {
+		addf("start.room", "unknown start room id %d", level.Data.Start.Room)
+	} else {
+		checkPoint("start.position", level.Data.Start.Room, level.Data.Start.Position)
+	}
+	level.validateObjectives(sizes, addf)
+
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Line < errs[j].Line })
+	return errs
+}
+
+// validateObjectives checks the level's objectives. A kill objective names
+// an enemy by sprite or by entity ID, as script filters do.
+func (level *Level) validateObjectives(sizes map[int][]int, addf func(path, format string, args ...interface{})) {
+	ids := make(map[string]bool)
+	for i, objective := range level.Data.Objectives {
+		path := fmt.Sprintf("objectives[%d]", i)
+		if objective.ID == "" {
+			addf(path+".id", "objective needs an id")
+		} else if ids[objective.ID] {
+			addf(path+".id", "duplicate objective id %q", objective.ID)
+		}
+		ids[objective.ID] = true
+		if objective.Text == "" {
+			addf(path+".text", "objective needs a text")
+		}
+		if objective.Count < 0 {
+			addf(path+".count", "count cannot be negative")
+		}
+
+		given := 0
+		for _, set := range []bool{objective.Collect != "", objective.Kill != "", objective.Reach != nil, objective.Var != ""} {
+			if set {
+				given++
+			}
+		}
+		if given != 1 {
+			addf(path, "objective needs exactly one of \"collect\", \"kill\", \"reach\" or \"var\"")
+			continue
+		}
+
+		switch {
+		case objective.Collect != "":
+			if _, _, ok := parseItemName(objective.Collect); !ok {
+				addf(path+".collect", "unknown item %q", objective.Collect)
+			}
+		case objective.Kill != "":
+			if _, err := strconv.Atoi(objective.Kill); err != nil {
+				if _, ok := ParseSpriteName(EntityEnemy, objective.Kill); !ok {
+					addf(path+".kill", "unknown enemy sprite %q (want one of %s, or an entity id)", objective.Kill, strings.Join(enemySpriteNames, ", "))
+				}
+			}
+		case objective.Reach != nil:
+			if _, ok := sizes[*objective.Reach]; !ok {
+				addf(path+".reach", "unknown room id %d", *objective.Reach)
+			}
+		case objective.Var != "":
+			if !isScriptName(objective.Var) {
+				addf(path+".var", "%q is not a variable name", objective.Var)
+			}
+		}
+	}
+}
+
+// validateWiring checks a room's targets and wires. Wires can only name
+// entities by an explicit "id", since those given by a layout are numbered
+// when the level is built.
+func (level *Level) validateWiring(def LevelRoom, path string, addf func(path, format string, args ...interface{}), checkPoint func(path string, roomID int, p []float32)) {
+	types := make(map[int]EntityType)
+	for _, entity := range def.Entities {
+		if entity.ID != nil {
+			types[*entity.ID], _ = ParseEntityType(entity.Type)
+		}
+	}
+
+	kinds := make(map[string]TargetKind)
+	for j, target := range def.Targets {
+		targetPath := fmt.Sprintf("%s.targets[%d]", path, j)
+		if target.ID == "" {
+			addf(targetPath+".id", "target needs an id")
+		} else if _, ok := kinds[target.ID]; ok {
+			addf(targetPath+".id", "duplicate target id %q", target.ID)
+		}
+
+		given := 0
+		for _, set := range []bool{target.Door != nil, target.Connection != nil, target.Tiles != nil, target.Entity != nil} {
+			if set {
+				given++
+			}
+		}
+		if given != 1 {
+			addf(targetPath, "target needs exactly one of \"door\", \"connection\", \"tiles\" or \"entity\"")
+			continue
+		}
+
+		switch {
+		case target.Door != nil:
+			kinds[target.ID] = TargetDoor
+			checkPoint(targetPath+".door", def.ID, target.Door)
+		case target.Connection != nil:
+			kinds[target.ID] = TargetConnection
+			checkPoint(targetPath+".connection", def.ID, target.Connection)
+			found := false
+			for _, conn := range def.Connections {
+				found = found || slices.Equal(conn.At, target.Connection)
+			}
+			if !found && len(target.Connection) == 3 {
+				p := target.Connection
+				addf(targetPath+".connection", "room %d has no connection at (%g,%g,%g)", def.ID, p[0], p[1], p[2])
+			}
+		case target.Tiles != nil:
+			kinds[target.ID] = TargetTiles
+			tiles := target.Tiles
+			if _, ok := ParseTileType(tiles.On); !ok {
+				addf(targetPath+".tiles.on", "unknown tile type %q", tiles.On)
+			}
+			if _, ok := ParseTileType(tiles.Off); tiles.Off != "" && !ok {
+				addf(targetPath+".tiles.off", "unknown tile type %q", tiles.Off)
+			}
+			for _, corner := range []struct {
+				name string
+				p    []int
+			}{{"from", tiles.From}, {"to", tiles.To}} {
+				if len(corner.p) != 3 {
+					addf(targetPath+".tiles."+corner.name, "expected [x, y, z]")
+					continue
+				}
+				checkPoint(targetPath+".tiles."+corner.name, def.ID, []float32{float32(corner.p[0]), float32(corner.p[1]), float32(corner.p[2])})
+			}
+		case target.Entity != nil:
+			kinds[target.ID] = TargetEntity
+			if _, ok := types[*target.Entity]; !ok {
+				addf(targetPath+".entity", "room %d has no entity with id %d", def.ID, *target.Entity)
+			}
+		}
+	}
+
+	for j, wire := range def.Wires {
+		wirePath := fmt.Sprintf("%s.wires[%d]", path, j)
+		if len(wire.Sources) == 0 {
+			addf(wirePath+".sources", "wire needs at least one source")
+		}
+		for _, id := range wire.Sources {
+			if entityType, ok := types[id]; !ok || entityType != EntitySwitch {
+				addf(wirePath+".sources", "room %d has no switch with id %d", def.ID, id)
+			}
+		}
+		logic, ok := ParseWireLogic(wire.Logic)
+		if wire.Logic != "" && !ok {
+			addf(wirePath+".logic", "unknown logic %q (want one of or, and, toggle, timed)", wire.Logic)
+		}
+		if logic == LogicTimed && wire.Time <= 0 {
+			addf(wirePath+".time", "a timed wire needs a time greater than 0")
+		}
+		action, ok := ParseWireAction(wire.Action)
+		if !ok {
+			addf(wirePath+".action", "unknown action %q (want one of open, close, enable, disable, set, spawn)", wire.Action)
+			continue
+		}
+		kind, ok := kinds[wire.Target]
+		if !ok {
+			addf(wirePath+".target", "room %d has no target %q", def.ID, wire.Target)
+		} else if actionTargets[action] != kind {
+			addf(wirePath+".action", "cannot %s target %q", wire.Action, wire.Target)
+		}
+	}
+}
+
+func (level *Level) errorf(path, format string, args ...interface{}) LevelError {
+	return LevelError{File: level.File, Line: level.lineOf(path), Msg: fmt.Sprintf(format, args...)}
+}
+
+// lineOf falls back to the closest enclosing value when the exact path is
+// missing, e.g. for a field that was left out of an object.
+func (level *Level) lineOf(path string) int {
+	for path != "" {
+		if line, ok := level.lines[path]; ok {
+			return line
+		}
+		cut := strings.LastIndexAny(path, ".[")
+		if cut < 0 {
+			break
+		}
+		path = path[:cut]
+	}
+	return level.lines[""]
+}
+
+func (level *Level) lineOfKey(key string) int {
+	best := 0
+	for path, line := range level.lines {
+		if (path == key || strings.HasSuffix(path, "."+key)) && (best == 0 || line < best) {
+			best = line
+		}
+	}
+	return best
+}
+
+// indexJSONLines maps every value in a JSON document to the line it starts
+// on, keyed by paths such as "rooms[0].connections[1].to_room".
+func indexJSONLines(data []byte) (map[string]int, error) {
+	lines := make(map[string]int)
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	var walk func(path string) error
+	walk = func(path string) error {
+		start := dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		lines[path] = lineAt(data, skipJSONSeparators(data, start))
+
+		delim, ok := tok.(json.Delim)
+		if !ok {
+			return nil
+		}
+
+		switch delim {
+		case '{':
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				child := key.(string)
+				if path != "" {
+					child = path + "." + child
+				}
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+		case '[':
+			for i := 0; dec.More(); i++ {
+				if err := walk(fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+
+		_, err = dec.Token()
+		return err
+	}
+
+	if err := walk(""); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+func skipJSONSeparators(data []byte, offset int64) int64 {
+	for offset < int64(len(data)) {
+		switch data[offset] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			offset++
+		default:
+			return offset
+		}
+	}
+	return offset
+}
+
+func lineAt(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+func jsonLevelError(file string, data []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		return LevelErrors{{File: file, Line: lineAt(data, syntaxErr.Offset), Msg: syntaxErr.Error()}}
+	case errors.As(err, &typeErr):
+		msg := fmt.Sprintf("%s: expected %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value)
+		return LevelErrors{{File: file, Line: lineAt(data, typeErr.Offset), Msg: msg}}
+	}
+	return LevelErrors{{File: file, Msg: err.Error()}}
+}
@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+// TestEntityIDs checks that entities without an id, from a layout or not,
+// are numbered after the ids the level gives.
+func TestEntityIDs(t *testing.T) {
+	level, err := ParseLevel("game_assets/levels/ids.json", []byte(`{"version": 1,
+ "start": {"room": 1, "position": [1, 1, 1]},
+ "rooms": [
+  {"id": 1, "name": "Library", "layout": "rooms/library.txt",
+   "entities": [
+     {"id": 0, "type": "item", "sprite": "gem", "at": [1, 1, 2]},
+     {"type": "item", "sprite": "gem", "at": [1, 1, 3]}
+   ]},
+  {"id": 2, "name": "Vault", "size": [4, 3, 4], "floor": "floor_stone",
+   "entities": [
+     {"id": 1, "type": "item", "sprite": "key", "at": [1, 1, 1]}
+   ]}
+ ]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fg := &FilmationGame{}
+	if err := fg.BuildLevel(level); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[Point3D]int{
+		{X: 1, Y: 1, Z: 2}: 0,
+		{X: 8, Y: 1, Z: 2}: 2,
+		{X: 1, Y: 1, Z: 3}: 3,
+	}
+	got := make(map[Point3D]int)
+	for _, entity := range fg.Rooms.Rooms[1].World.Entities {
+		got[entity.Position] = entity.ID
+	}
+	for pos, id := range want {
+		if got[pos] != id {
+			t.Errorf("entity at %v has id %d, want %d", pos, got[pos], id)
+		}
+	}
+}
+
+func TestDuplicateEntityID(t *testing.T) {
+	level, err := ParseLevel("ids.json", []byte(`{"version": 1,
+ "start": {"room": 1, "position": [1, 1, 1]},
+ "rooms": [
+  {"id": 1, "name": "Hall", "size": [4, 3, 4], "floor": "floor_stone",
+   "entities": [{"id": 5, "type": "item", "sprite": "gem", "at": [2, 1, 2]}]},
+  {"id": 2, "name": "Vault", "size": [4, 3, 4], "floor": "floor_stone",
+   "entities": [{"id": 5, "type": "item", "sprite": "key", "at": [1, 1, 1]}]}
+ ]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "ids.json:7: duplicate entity id 5, also given by rooms[0].entities[0]"
+	if errs := level.Validate(); len(errs) != 1 || errs.Error() != want {
+		t.Errorf("got errors %v, want %q", errs, want)
+	}
+}
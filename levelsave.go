@@ -0,0 +1,436 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// EncodeLevel describes the current mansion as a level file. Tiles are
+// written out explicitly rather than as floors or layouts, so that loading
+// the result rebuilds every room exactly as it is now. The player is not
+// part of any room; it becomes the level's start position instead.
+func (fg *FilmationGame) EncodeLevel() LevelFile {
+	// The room being played is newer than its stored copy.
+	fg.storeRoom()
+
+	level := LevelFile{
+		Version: LevelFormatVersion,
+		Start:   LevelStart{Room: fg.Rooms.CurrentRoom},
+		Script:  fg.LevelScript,
+	}
+	if fg.Player != nil {
+		level.Start.Position = pointToLevel(fg.Player.Position)
+	}
+	for _, objective := range fg.Objectives {
+		level.Objectives = append(level.Objectives, encodeObjective(objective))
+	}
+
+	ids := make([]int, 0, len(fg.Rooms.Rooms))
+	for id := range fg.Rooms.Rooms {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		level.Rooms = append(level.Rooms, encodeRoom(fg.Rooms.Rooms[id]))
+	}
+
+	return level
+}
+
+func (fg *FilmationGame) SaveLevel(path string) error {
+	level := fg.EncodeLevel()
+	data, err := MarshalLevel(&level)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("Saved %d rooms to %s\n", len(level.Rooms), path)
+	return nil
+}
+
+func encodeRoom(room *Room) LevelRoom {
+	world := &room.World
+	def := LevelRoom{
+		ID:   room.ID,
+		Name: room.Name,
+		Size: []int{world.Width, world.Height, world.Depth},
+
+		Storey:       room.Storey,
+		ResetEnemies: room.ResetEnemies,
+		Script:       room.Script,
+	}
+
+	for y := 0; y < world.Height; y++ {
+		layer := LevelLayer{Y: y, Tiles: encodeLayer(world, y)}
+		if len(layer.Tiles) > 0 {
+			def.Layers = append(def.Layers, layer)
+		}
+	}
+
+	for _, conn := range room.Connections {
+		connDef := LevelConnection{
+			At:          pointToLevel(conn.Position),
+			ToRoom:      conn.ToRoomID,
+			To:          pointToLevel(conn.ToPosition),
+			Direction:   directionNames[conn.Direction],
+			RequiresKey: conn.RequiresKey,
+			Key:         conn.Key,
+			ConsumeKey:  conn.ConsumeKey,
+		}
+		if !conn.Active {
+			active := false
+			connDef.Active = &active
+		}
+		def.Connections = append(def.Connections, connDef)
+	}
+
+	for _, entity := range world.Entities {
+		if entity.Type == EntityPlayer {
+			continue
+		}
+		def.Entities = append(def.Entities, encodeEntity(entity))
+	}
+
+	for _, target := range room.Targets {
+		def.Targets = append(def.Targets, encodeTarget(target))
+	}
+	for _, wire := range room.Wires {
+		def.Wires = append(def.Wires, LevelWire{
+			Sources: wire.Sources,
+			Logic:   wireLogicNames[wire.Logic],
+			Time:    wire.Time,
+			Action:  wireActionNames[wire.Action],
+			Target:  wire.Target,
+			Input:   wire.Input,
+			On:      wire.On,
+			Applied: wire.Applied,
+			Timer:   wire.Timer,
+		})
+	}
+
+	return def
+}
+
+func encodeObjective(objective Objective) LevelObjective {
+	def := LevelObjective{
+		ID:       objective.ID,
+		Text:     objective.Text,
+		Count:    objective.Count,
+		Optional: objective.Optional,
+		Progress: objective.Progress,
+	}
+	switch objective.Kind {
+	case ObjectiveCollect:
+		def.Collect = objective.Target
+	case ObjectiveKill:
+		def.Kill = objective.Target
+	case ObjectiveReach:
+		room, _ := strconv.Atoi(objective.Target)
+		def.Reach = &room
+	case ObjectiveVar:
+		def.Var = objective.Target
+	}
+	return def
+}
+
+// encodeTarget always writes a tiles target's Off tile, since by the time
+// the level is saved the tiles may have been changed to On.
+func encodeTarget(target WireTarget) LevelTarget {
+	def := LevelTarget{ID: target.ID}
+	switch target.Kind {
+	case TargetDoor:
+		def.Door = pointToLevel(target.At)
+	case TargetConnection:
+		def.Connection = pointToLevel(target.At)
+	case TargetTiles:
+		def.Tiles = &LevelTargetTiles{
+			From: target.From[:],
+			To:   target.To[:],
+			On:   target.On.String(),
+			Off:  target.Off.String(),
+		}
+	case TargetEntity:
+		entity := target.Entity
+		def.Entity = &entity
+	}
+	return def
+}
+
+// encodeLayer covers the tiles of one Y level with as few rectangles as a
+// simple greedy scan finds. Tiles whose Position is not their grid cell are
+// written one by one.
+func encodeLayer(world *World3D, y int) []LevelTile {
+	var tiles []LevelTile
+	done := make([][]bool, world.Width)
+	for x := range done {
+		done[x] = make([]bool, world.Depth)
+	}
+
+	sameTile := func(a, b Tile3D) bool {
+		return a.Type == b.Type && a.Solid == b.Solid && a.Height == b.Height
+	}
+	onGrid := func(tile Tile3D, x, z int) bool {
+		return tile.Position == Point3D{X: float32(x), Y: float32(y), Z: float32(z)}
+	}
+
+	for z := 0; z < world.Depth; z++ {
+		for x := 0; x < world.Width; x++ {
+			tile := world.Tiles[x][y][z]
+			if done[x][z] || tile == (Tile3D{}) {
+				continue
+			}
+
+			def := LevelTile{Type: tile.Type.String()}
+			if tile.Solid != IsTileSolidByDefault(tile.Type) {
+				solid := tile.Solid
+				def.Solid = &solid
+			}
+			if tile.Height != 1.0 {
+				height := tile.Height
+				def.Height = &height
+			}
+
+			if !onGrid(tile, x, z) {
+				def.At = []int{x, z}
+				def.Position = pointToLevel(tile.Position)
+				done[x][z] = true
+				tiles = append(tiles, def)
+				continue
+			}
+
+			fits := func(cx, cz int) bool {
+				other := world.Tiles[cx][y][cz]
+				return !done[cx][cz] && sameTile(tile, other) && onGrid(other, cx, cz)
+			}
+
+			toX := x
+			for toX+1 < world.Width && fits(toX+1, z) {
+				toX++
+			}
+			toZ := z
+			for toZ+1 < world.Depth {
+				row := true
+				for cx := x; cx <= toX && row; cx++ {
+					row = fits(cx, toZ+1)
+				}
+				if !row {
+					break
+				}
+				toZ++
+			}
+
+			for cx := x; cx <= toX; cx++ {
+				for cz := z; cz <= toZ; cz++ {
+					done[cx][cz] = true
+				}
+			}
+
+			if toX == x && toZ == z {
+				def.At = []int{x, z}
+			} else {
+				def.From = []int{x, z}
+				def.To = []int{toX, toZ}
+			}
+			tiles = append(tiles, def)
+		}
+	}
+
+	return tiles
+}
+
+// encodeEntity writes out every field that differs from what loading the
+// entity's type, sprite and position would give.
+func encodeEntity(entity GameEntity) LevelEntity {
+	id := entity.ID
+	def := LevelEntity{
+		ID:        &id,
+		Type:      entityTypeNames[entity.Type],
+		At:        pointToLevel(entity.Position),
+		MoveSpeed: entity.MoveSpeed,
+		MoveTimer: entity.MoveTimer,
+		Frame:     entity.Frame,
+		AnimSpeed: entity.AnimSpeed,
+		Moving:    entity.IsMoving,
+		VelocityY: entity.VelocityY,
+		Key:       entity.Key,
+	}
+
+	if names := spriteNamesFor(entity.Type); entity.SpriteID >= 0 && entity.SpriteID < len(names) {
+		def.Sprite = names[entity.SpriteID]
+	} else {
+		spriteID := entity.SpriteID
+		def.SpriteID = &spriteID
+	}
+
+	if entity.Direction != DirDown {
+		def.Direction = directionNames[entity.Direction]
+	}
+
+	defaults := NewEntity(entity.ID, entity.Type, entity.Position, entity.SpriteID)
+	if entity.Health != defaults.Health || entity.MaxHealth != defaults.MaxHealth {
+		health := entity.Health
+		def.Health = &health
+		if entity.MaxHealth != entity.Health {
+			maxHealth := entity.MaxHealth
+			def.MaxHealth = &maxHealth
+		}
+	}
+	if !entity.Active {
+		active := false
+		def.Active = &active
+	}
+	if entity.Color != rl.White {
+		def.Color = []int{int(entity.Color.R), int(entity.Color.G), int(entity.Color.B), int(entity.Color.A)}
+	}
+	if entity.Bounds != defaults.Bounds {
+		def.Bounds = &LevelBounds{Min: pointToLevel(entity.Bounds.Min), Max: pointToLevel(entity.Bounds.Max)}
+	}
+	if entity.TargetPosition != entity.Position {
+		def.Target = pointToLevel(entity.TargetPosition)
+	}
+	def.Path = pathToLevel(entity.Path)
+	def.PathIndex = entity.PathIndex
+	def.PathProgress = entity.PathProgress
+	def.On = entity.On
+	def.Script = entity.Script
+	def.Dialogue = entity.Dialogue
+
+	return def
+}
+
+func pointToLevel(p Point3D) []float32 {
+	return []float32{p.X, p.Y, p.Z}
+}
+
+func pathToLevel(path []Point3D) [][]float32 {
+	var points [][]float32
+	for _, p := range path {
+		points = append(points, pointToLevel(p))
+	}
+	return points
+}
+
+// MarshalLevel formats a level the way level files are written by hand:
+// anything that fits on a line is kept on one line.
+func MarshalLevel(level *LevelFile) ([]byte, error) {
+	data, err := json.Marshal(level)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	root, err := readJSONNode(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	root.write(&buf, "")
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+const levelLineWidth = 100
+
+type jsonNode struct {
+	scalar string
+	open   json.Delim
+	keys   []string
+	items  []*jsonNode
+}
+
+func readJSONNode(dec *json.Decoder) (*jsonNode, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		scalar, err := json.Marshal(tok)
+		return &jsonNode{scalar: string(scalar)}, err
+	}
+
+	node := &jsonNode{open: delim}
+	for dec.More() {
+		if delim == '{' {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			node.keys = append(node.keys, key.(string))
+		}
+		item, err := readJSONNode(dec)
+		if err != nil {
+			return nil, err
+		}
+		node.items = append(node.items, item)
+	}
+	_, err = dec.Token()
+	return node, err
+}
+
+func (node *jsonNode) compact() string {
+	if node.open == 0 {
+		return node.scalar
+	}
+
+	parts := make([]string, len(node.items))
+	for i, item := range node.items {
+		parts[i] = item.compact()
+		if node.open == '{' {
+			key, _ := json.Marshal(node.keys[i])
+			parts[i] = string(key) + ": " + parts[i]
+		}
+	}
+
+	if node.open == '[' {
+		return "[" + strings.Join(parts, ", ") + "]"
+	}
+	if len(parts) == 0 {
+		return "{}"
+	}
+	return "{ " + strings.Join(parts, ", ") + " }"
+}
+
+func (node *jsonNode) write(buf *bytes.Buffer, indent string) {
+	if line := node.compact(); len(indent)+len(line) <= levelLineWidth {
+		buf.WriteString(line)
+		return
+	}
+
+	closeDelim := "]"
+	if node.open == '{' {
+		closeDelim = "}"
+	}
+	buf.WriteString(node.open.String() + "\n")
+
+	inner := indent + "  "
+	for i, item := range node.items {
+		buf.WriteString(inner)
+		if node.open == '{' {
+			key, _ := json.Marshal(node.keys[i])
+			buf.Write(key)
+			buf.WriteString(": ")
+		}
+		item.write(buf, inner)
+		if i < len(node.items)-1 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('\n')
+	}
+	buf.WriteString(indent + closeDelim)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// roundTrip saves the game's mansion as a level file and builds a new game
+// from it.
+func roundTrip(t *testing.T, fg *FilmationGame) *FilmationGame {
+	t.Helper()
+	level := fg.EncodeLevel()
+	data, err := MarshalLevel(&level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseLevel("roundtrip.json", data)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, data)
+	}
+	loaded := &FilmationGame{}
+	if err := loaded.BuildLevel(parsed); err != nil {
+		t.Fatalf("%v\n%s", err, data)
+	}
+	loaded.storeRoom()
+	return loaded
+}
+
+// compareFields reports every field of the structs a and b that differs.
+func compareFields(t *testing.T, what string, a, b interface{}) {
+	t.Helper()
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	for i := 0; i < va.NumField(); i++ {
+		fa, fb := va.Field(i), vb.Field(i)
+		if !reflect.DeepEqual(fa.Interface(), fb.Interface()) {
+			t.Errorf("%s: %s is %+v, loaded back as %+v", what, va.Type().Field(i).Name, fa.Interface(), fb.Interface())
+		}
+	}
+}
+
+// unsetFields returns the fields of type T that are zero in every one of
+// values.
+func unsetFields[T any](values []T) []string {
+	var unset []string
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	for i := 0; i < typ.NumField(); i++ {
+		set := false
+		for _, v := range values {
+			set = set || !reflect.ValueOf(v).Field(i).IsZero()
+		}
+		if !set {
+			unset = append(unset, typ.Field(i).Name)
+		}
+	}
+	return unset
+}
+
+func roomEntities(room *Room) []GameEntity {
+	var entities []GameEntity
+	for _, entity := range room.World.Entities {
+		if entity.Type != EntityPlayer {
+			entities = append(entities, entity)
+		}
+	}
+	return entities
+}
+
+// checkRoundTrip checks that every room comes back from a level file as it
+// was, tile by tile, connection by connection and entity by entity.
+func checkRoundTrip(t *testing.T, fg *FilmationGame) {
+	t.Helper()
+	loaded := roundTrip(t, fg)
+
+	if loaded.Rooms.CurrentRoom != fg.Rooms.CurrentRoom {
+		t.Errorf("current room is %d, loaded back as %d", fg.Rooms.CurrentRoom, loaded.Rooms.CurrentRoom)
+	}
+	if loaded.Player.Position != fg.Player.Position {
+		t.Errorf("player is at %+v, loaded back at %+v", fg.Player.Position, loaded.Player.Position)
+	}
+	if len(loaded.Rooms.Rooms) != len(fg.Rooms.Rooms) {
+		t.Fatalf("%d rooms loaded back as %d", len(fg.Rooms.Rooms), len(loaded.Rooms.Rooms))
+	}
+
+	for id, room := range fg.Rooms.Rooms {
+		other := loaded.Rooms.Rooms[id]
+		if other == nil {
+			t.Errorf("room %d is missing", id)
+			continue
+		}
+		if room.Name != other.Name || room.Storey != other.Storey || room.ResetEnemies != other.ResetEnemies || room.Script != other.Script {
+			t.Errorf("room %d: %q storey %d reset %v script %q, loaded back as %q storey %d reset %v script %q", id,
+				room.Name, room.Storey, room.ResetEnemies, room.Script, other.Name, other.Storey, other.ResetEnemies, other.Script)
+		}
+		if !reflect.DeepEqual(room.Targets, other.Targets) || !reflect.DeepEqual(room.Wires, other.Wires) {
+			t.Errorf("room %d: wiring differs", id)
+		}
+
+		w, ow := &room.World, &other.World
+		if w.Width != ow.Width || w.Height != ow.Height || w.Depth != ow.Depth {
+			t.Errorf("room %d: size %dx%dx%d, loaded back as %dx%dx%d", id, w.Width, w.Height, w.Depth, ow.Width, ow.Height, ow.Depth)
+			continue
+		}
+		for x := range w.Tiles {
+			for y := range w.Tiles[x] {
+				for z := range w.Tiles[x][y] {
+					compareFields(t, "room "+room.Name+" tile", w.Tiles[x][y][z], ow.Tiles[x][y][z])
+				}
+			}
+		}
+
+		if len(room.Connections) != len(other.Connections) {
+			t.Errorf("room %d: %d connections, loaded back as %d", id, len(room.Connections), len(other.Connections))
+		} else {
+			for i := range room.Connections {
+				compareFields(t, "room "+room.Name+" connection", room.Connections[i], other.Connections[i])
+			}
+		}
+
+		entities, otherEntities := roomEntities(room), roomEntities(other)
+		if len(entities) != len(otherEntities) {
+			t.Errorf("room %d: %d entities, loaded back as %d", id, len(entities), len(otherEntities))
+			continue
+		}
+		for i := range entities {
+			compareFields(t, "room "+room.Name+" entity", entities[i], otherEntities[i])
+		}
+	}
+}
+
+func TestRoundTripMansion(t *testing.T) {
+	fg := &FilmationGame{}
+	if err := fg.LoadLevel("game_assets/levels/mansion.json"); err != nil {
+		t.Fatal(err)
+	}
+	checkRoundTrip(t, fg)
+}
+
+func TestRoundTripGeneratedMansion(t *testing.T) {
+	for _, seed := range []int64{1, 2, 3} {
+		fg := &FilmationGame{}
+		if err := fg.GenerateMansion(DefaultMansionParams(seed)); err != nil {
+			t.Fatal(err)
+		}
+		checkRoundTrip(t, fg)
+	}
+}
+
+// TestRoundTripEveryField builds rooms by hand in which every field of
+// every tile, connection and entity is set to something other than its
+// default in at least one of them.
+func TestRoundTripEveryField(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "hall.script")
+	dialogue := filepath.Join(dir, "butler.dialogue")
+	if err := os.WriteFile(script, []byte("on enter_room 1\n    set visits 1\nend\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dialogue, []byte("name \"Butler\"\n\nnode start\n    say \"Sir.\"\nend\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fg := &FilmationGame{}
+	fg.InitRoomSystem()
+	hall := fg.CreateRoom(1, "Hall", 8, 4, 8)
+	fg.BuildBasicRoom(hall, TileWoodFloor)
+	hall.Storey = 1
+	hall.ResetEnemies = true
+	hall.Script = script
+	cellar := fg.CreateRoom(2, "Cellar", 6, 3, 6)
+	fg.BuildBasicRoom(cellar, TileStoneFloor)
+
+	hall.World.Tiles[2][1][2] = Tile3D{Type: TilePillar, Position: Point3D{X: 2.5, Y: 1, Z: 2.25}, Solid: false, Height: 0.5}
+	hall.World.Tiles[3][1][2] = Tile3D{Type: TileBrickWall, Position: Point3D{X: 3, Y: 1, Z: 2}, Solid: true, Height: 2}
+	hall.World.Tiles[4][3][4] = NewTile(TileCeiling, 4, 3, 4)
+
+	fg.AddRoomConnection(1, 2, Point3D{X: 7, Y: 1, Z: 3}, Point3D{X: 1, Y: 1, Z: 3}, DirRight, true)
+	locked := &hall.Connections[len(hall.Connections)-1]
+	locked.Key = "cellar"
+	locked.ConsumeKey = true
+	fg.AddRoomConnection(1, 2, Point3D{X: 3, Y: 1, Z: 0}, Point3D{X: 3, Y: 1, Z: 4}, DirUp, false)
+	hall.Connections[len(hall.Connections)-1].Active = false
+	fg.AddRoomConnection(2, 1, Point3D{X: 0, Y: 1, Z: 3}, Point3D{X: 6, Y: 1, Z: 3}, DirLeft, true)
+	// A door that has been unlocked keeps the name of its key.
+	unlocked := &cellar.Connections[len(cellar.Connections)-1]
+	unlocked.Key = "cellar"
+	unlocked.ConsumeKey = true
+	unlocked.RequiresKey = false
+
+	butler := NewEntity(40, EntityNPC, Point3D{X: 5, Y: 1, Z: 5}, 2)
+	butler.Bounds = BoundingBox3D{Min: Point3D{X: 4.8, Y: 1, Z: 4.8}, Max: Point3D{X: 5.2, Y: 2.5, Z: 5.2}}
+	butler.Direction = DirLeft
+	butler.Color = rl.Color{R: 10, G: 20, B: 30, A: 200}
+	butler.Health = 7
+	butler.MaxHealth = 9
+	butler.Frame = 3
+	butler.AnimSpeed = 0.25
+	butler.TargetPosition = Point3D{X: 5, Y: 1, Z: 6}
+	butler.IsMoving = true
+	butler.MoveSpeed = 1.5
+	butler.MoveTimer = 0.75
+	butler.VelocityY = -2
+	butler.Script = script
+	butler.Dialogue = dialogue
+
+	key := NewEntity(41, EntityItem, Point3D{X: 2, Y: 1, Z: 5}, keySpriteID)
+	key.Key = "cellar"
+	key.Active = false
+
+	lever := NewEntity(42, EntitySwitch, Point3D{X: 1, Y: 1, Z: 1}, 0)
+	lever.On = true
+
+	lift := NewEntity(43, EntityPlatform, Point3D{X: 4, Y: 1, Z: 1}, 0)
+	lift.Path = []Point3D{{X: 4, Y: 1, Z: 1}, {X: 6, Y: 1, Z: 1}}
+	lift.PathIndex = 1
+	lift.PathProgress = 0.5
+
+	hall.World.Entities = append(hall.World.Entities, butler, key, lever, lift)
+	cellar.World.Entities = append(cellar.World.Entities, NewEntity(44, EntityEnemy, Point3D{X: 3, Y: 1, Z: 3}, 1))
+
+	var tiles []Tile3D
+	for x := range hall.World.Tiles {
+		for y := range hall.World.Tiles[x] {
+			tiles = append(tiles, hall.World.Tiles[x][y]...)
+		}
+	}
+	if unset := unsetFields(tiles); unset != nil {
+		t.Fatalf("no tile sets %v", unset)
+	}
+	if unset := unsetFields(hall.Connections); unset != nil {
+		t.Fatalf("no connection sets %v", unset)
+	}
+	if unset := unsetFields(hall.World.Entities); unset != nil {
+		t.Fatalf("no entity sets %v", unset)
+	}
+
+	fg.SetupPlayerInRoom(1, Point3D{X: 3, Y: 1, Z: 3})
+	checkRoundTrip(t, fg)
+}
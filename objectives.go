@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// Objectives are what a level asks of the player: collect the gems, defeat
+// the troll, reach the library. They are declared in the level file and
+// move on with the events scripts hear, pickups, kills and rooms entered,
+// or with a script variable. Once every objective that is not optional is
+// complete, the game is won.
+
+type ObjectiveKind int
+
+const (
+	ObjectiveCollect ObjectiveKind = iota
+	ObjectiveKill
+	ObjectiveReach
+	ObjectiveVar
+)
+
+// Objective is one objective and how far the player has got with it.
+// Target is an item as parseItemName reads it for a collect objective, an
+// enemy sprite or entity ID for a kill, a room ID for a reach and a
+// variable for a var. A Count of 0 means every matching item or enemy in
+// the mansion; a var objective is met when the variable reaches Count, or
+// 1.
+type Objective struct {
+	ID       string
+	Text     string
+	Kind     ObjectiveKind
+	Target   string
+	Count    int
+	Optional bool
+	Progress int
+	Done     bool
+
+	// need is Count with 0 worked out. See countObjectives.
+	need int
+}
+
+// advanceObjectives counts an event towards the objectives it matches.
+// FireHook calls it for every hook, before any script runs.
+func (fg *FilmationGame) advanceObjectives(hook ScriptHook, entity *GameEntity) {
+	for i := range fg.Objectives {
+		o := &fg.Objectives[i]
+		if o.Done {
+			continue
+		}
+		switch {
+		case o.Kind == ObjectiveCollect && hook == HookPickup && entity != nil && o.matches(entity):
+			o.Progress++
+		case o.Kind == ObjectiveKill && hook == HookEnemyKilled && entity != nil && o.matches(entity):
+			o.Progress++
+		case o.Kind == ObjectiveReach && hook == HookEnterRoom && o.Target == strconv.Itoa(fg.Rooms.CurrentRoom):
+			o.Progress = 1
+		}
+	}
+	fg.checkObjectives(true)
+}
+
+// UpdateObjectives follows the variables that var objectives watch, which
+// scripts and dialogues can change at any time.
+func (fg *FilmationGame) UpdateObjectives() {
+	for i := range fg.Objectives {
+		if o := &fg.Objectives[i]; o.Kind == ObjectiveVar && !o.Done {
+			o.Progress = max(0, min(fg.ScriptVars[o.Target], o.need))
+		}
+	}
+	fg.checkObjectives(true)
+}
+
+// matches reports whether entity is one of the items or enemies a collect
+// or kill objective counts.
+func (o *Objective) matches(entity *GameEntity) bool {
+	switch o.Kind {
+	case ObjectiveCollect:
+		spriteID, key, _ := parseItemName(o.Target)
+		return entity.Type == EntityItem && entity.SpriteID == spriteID && (key == "" || entity.Key == key)
+	case ObjectiveKill:
+		if entity.Type != EntityEnemy {
+			return false
+		}
+		if id, err := strconv.Atoi(o.Target); err == nil {
+			return entity.ID == id
+		}
+		spriteID, _ := ParseSpriteName(EntityEnemy, o.Target)
+		return entity.SpriteID == spriteID
+	}
+	return false
+}
+
+// countObjectives works out how many each objective needs. One with a Count
+// of 0 needs what the player has already done plus every matching item or
+// enemy still in the mansion, so that it comes out the same whether the
+// game is new or loaded from a save.
+func (fg *FilmationGame) countObjectives() {
+	for i := range fg.Objectives {
+		o := &fg.Objectives[i]
+		o.need = o.Count
+		if o.Count > 0 {
+			continue
+		}
+		if o.Kind != ObjectiveCollect && o.Kind != ObjectiveKill {
+			o.need = 1
+			continue
+		}
+		if _, err := strconv.Atoi(o.Target); err == nil && o.Kind == ObjectiveKill {
+			o.need = 1
+			continue
+		}
+
+		o.need = o.Progress
+		count := func(entities []GameEntity) {
+			for j := range entities {
+				if entities[j].Active && o.matches(&entities[j]) {
+					o.need++
+				}
+			}
+		}
+		count(fg.World.Entities)
+		for id, room := range fg.Rooms.Rooms {
+			if id != fg.Rooms.CurrentRoom {
+				count(room.World.Entities)
+			}
+		}
+	}
+}
+
+// checkObjectives marks objectives that have been met as done, and wins the
+// game once every one that is not optional is. With announce set, each is
+// shown on screen as it completes.
+func (fg *FilmationGame) checkObjectives(announce bool) {
+	won, main := true, 0
+	for i := range fg.Objectives {
+		o := &fg.Objectives[i]
+		if !o.Done && o.Progress >= o.need {
+			o.Done = true
+			if announce {
+				fg.ShowMessage(fmt.Sprintf("Objective complete: %s", o.Text))
+			}
+		}
+		if !o.Optional {
+			main++
+			won = won && o.Done
+		}
+	}
+
+	if won && main > 0 && !fg.Won {
+		fg.Won = true
+		if announce {
+			fg.ShowMessage("Every objective is complete. You win!")
+		}
+	}
+}
+
+// renderObjectives lists the objectives down the right of the screen, with
+// those done ticked off and optional ones greyed.
+func (fg *FilmationGame) renderObjectives() {
+	if len(fg.Objectives) == 0 {
+		return
+	}
+
+	x, y := fg.ScreenW-230, int32(10)
+	rl.DrawText("OBJECTIVES", x, y, 10, rl.Gold)
+	for _, o := range fg.Objectives {
+		y += 15
+		mark, color := "[ ]", rl.White
+		if o.Optional {
+			color = rl.Gray
+		}
+		if o.Done {
+			mark, color = "[x]", rl.Color{R: 100, G: 200, B: 100, A: 255}
+		}
+		text := fmt.Sprintf("%s %s", mark, o.Text)
+		if o.need > 1 {
+			text += fmt.Sprintf(" (%d/%d)", min(o.Progress, o.need), o.need)
+		}
+		if o.Optional {
+			text += " (optional)"
+		}
+		rl.DrawText(text, x, y, 10, color)
+	}
+}
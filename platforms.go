@@ -0,0 +1,134 @@
+package main
+
+import "slices"
+
+// Platforms are floors that move. A platform travels in straight lines
+// between the waypoints of its path, going back to the first after the
+// last, so one with two waypoints goes back and forth like a lift. It stops
+// for a moment at each waypoint. Whatever stands on a platform, and whatever
+// is stacked on that, rides along with it.
+//
+// A platform never pushes anything into a wall. If it would carry something
+// into a solid cell, or run into something that is not riding on it, it
+// waits where it is until the way is clear.
+
+const (
+	platformSpeed = 2.0 // cells per second, for platforms without a move speed
+	platformWait  = 1.0 // seconds spent at each waypoint
+)
+
+// UpdatePlatforms moves every platform along its path for one frame.
+func (fg *FilmationGame) UpdatePlatforms(deltaTime float32) {
+	for i := range fg.World.Entities {
+		platform := &fg.World.Entities[i]
+		if platform.Active && platform.Type == EntityPlatform && len(platform.Path) > 1 {
+			fg.movePlatform(platform, deltaTime)
+		}
+	}
+}
+
+func (fg *FilmationGame) movePlatform(platform *GameEntity, deltaTime float32) {
+	if platform.MoveTimer > 0 {
+		platform.MoveTimer -= deltaTime
+		return
+	}
+
+	from := platform.Path[platform.PathIndex]
+	to := platform.Path[(platform.PathIndex+1)%len(platform.Path)]
+	speed := platform.MoveSpeed
+	if speed <= 0 {
+		speed = platformSpeed
+	}
+
+	progress := float32(1)
+	if length := abs(to.X-from.X) + abs(to.Y-from.Y) + abs(to.Z-from.Z); length > 0 {
+		progress = platform.PathProgress + speed*deltaTime/length
+	}
+	next := LerpPoint3D(from, to, progress)
+	delta := Point3D{
+		X: next.X - platform.Position.X,
+		Y: next.Y - platform.Position.Y,
+		Z: next.Z - platform.Position.Z,
+	}
+
+	riders := fg.riders(platform)
+	moving := append([]*GameEntity{platform}, riders...)
+	for _, entity := range moving {
+		if fg.bumps(offset(entity.Position, delta), moving) {
+			return
+		}
+	}
+
+	for _, entity := range moving {
+		entity.Position = offset(entity.Position, delta)
+		entity.TargetPosition = offset(entity.TargetPosition, delta)
+		if entity == fg.Player {
+			fg.UpdatePlayerBounds()
+		} else {
+			fg.UpdateEntityBounds(entity)
+		}
+	}
+
+	if progress >= 1 {
+		platform.PathIndex = (platform.PathIndex + 1) % len(platform.Path)
+		platform.PathProgress = 0
+		platform.MoveTimer = platformWait
+	} else {
+		platform.PathProgress = progress
+	}
+}
+
+// riders lists what is standing on a platform, and on top of that.
+func (fg *FilmationGame) riders(platform *GameEntity) []*GameEntity {
+	candidates := fg.Party()
+	for i := range fg.World.Entities {
+		entity := &fg.World.Entities[i]
+		if entity.Active && entity.Type != EntityPlatform {
+			candidates = append(candidates, entity)
+		}
+	}
+
+	var riders []*GameEntity
+	bases := []*GameEntity{platform}
+	for len(bases) > 0 {
+		base := bases[0]
+		bases = bases[1:]
+		for _, entity := range candidates {
+			if !slices.Contains(riders, entity) && standsOn(entity, base) {
+				riders = append(riders, entity)
+				bases = append(bases, entity)
+			}
+		}
+	}
+	return riders
+}
+
+func standsOn(top, base *GameEntity) bool {
+	topCell, baseCell := cellOf(top.Position), cellOf(base.Position)
+	return top.VelocityY <= 0 && topCell[0] == baseCell[0] && topCell[2] == baseCell[2] &&
+		abs(top.Position.Y-base.Position.Y-1) < 0.01
+}
+
+// bumps reports whether something moving to pos with the given entities
+// would run into anything else: what IsPositionSolid counts, or one of the
+// party.
+func (fg *FilmationGame) bumps(pos Point3D, moving []*GameEntity) bool {
+	if fg.World.IsPositionSolidExcept(pos, moving) {
+		return true
+	}
+
+	checkBounds := BoundingBox3D{
+		Min: Point3D{X: pos.X - 0.4, Y: pos.Y - 0.4, Z: pos.Z - 0.4},
+		Max: Point3D{X: pos.X + 0.4, Y: pos.Y + 0.4, Z: pos.Z + 0.4},
+	}
+	for _, entity := range fg.Party() {
+		if !slices.Contains(moving, entity) && BoundingBoxesIntersect(checkBounds, entity.Bounds) {
+			return true
+		}
+	}
+	return false
+}
+
+func offset(p, delta Point3D) Point3D {
+	return Point3D{X: p.X + delta.X, Y: p.Y + delta.Y, Z: p.Z + delta.Z}
+}
@@ -38,8 +38,18 @@ func (fg *FilmationGame) WorldToScreen(p Point3D) Point2D {
 func (fg *FilmationGame) CalculateRenderOrder() {
 	fg.RenderOrder = nil
 
+	// In a room with storeys above the player's, those storeys are left
+	// out so the player can be seen.
+	height := fg.World.Height
+	if fg.Player != nil {
+		standing := storeyOf(fg.Player.Position.Y+0.5)*2 + 1
+		if fg.World.hasStoreyAbove(standing) {
+			height = standing + 1
+		}
+	}
+
 	for x := 0; x < fg.World.Width; x++ {
-		for y := 0; y < fg.World.Height; y++ {
+		for y := 0; y < height; y++ {
 			for z := 0; z < fg.World.Depth; z++ {
 				tile := &fg.World.Tiles[x][y][z]
 				if tile.Type != TileEmpty {
@@ -58,16 +68,26 @@ func (fg *FilmationGame) CalculateRenderOrder() {
 		}
 	}
 
-	for i, entity := range fg.World.Entities {
-		if entity.Active {
+	entities := fg.Party()
+	for i := range fg.World.Entities {
+		entities = append(entities, &fg.World.Entities[i])
+	}
+
+	for _, entity := range entities {
+		if entity.Active && int(entity.Position.Y+0.5) < height {
 			depth := entity.Position.X + entity.Position.Z + entity.Position.Y*2
+			if entity.Type == EntitySwitch {
+				// Switches lie on the floor, under whatever stands on them.
+				depth -= 0.5
+			}
 
 			renderItem := RenderItem{
-				Position: entity.Position,
-				Depth:    depth,
-				Type:     "entity",
-				TileData: nil,
-				EntityID: i,
+				Position:   entity.Position,
+				Depth:      depth,
+				Type:       "entity",
+				TileData:   nil,
+				EntityData: entity,
+				EntityID:   entity.ID,
 			}
 			fg.RenderOrder = append(fg.RenderOrder, renderItem)
 		}
@@ -122,11 +142,21 @@ func (fg *FilmationGame) RenderTile(tile *Tile3D) {
 		renderY -= 40
 	}
 
+	if tile.Type == TileDoor {
+		open := fg.doorOpenness(tile)
+		if open < 1 {
+			rl.DrawTexture(texture, int32(renderX), int32(renderY), doorTint(1-open))
+		}
+		if open > 0 {
+			rl.DrawTexture(fg.Sprites.DoorTiles[1], int32(renderX), int32(renderY), doorTint(open))
+		}
+		return
+	}
+
 	rl.DrawTexture(texture, int32(renderX), int32(renderY), rl.White)
 }
 
-func (fg *FilmationGame) RenderEntity(entityID int) {
-	entity := &fg.World.Entities[entityID]
+func (fg *FilmationGame) RenderEntity(entity *GameEntity) {
 	if !entity.Active {
 		return
 	}
@@ -136,12 +166,19 @@ func (fg *FilmationGame) RenderEntity(entityID int) {
 	var texture rl.Texture2D
 
 	switch entity.Type {
-	case EntityPlayer:
+	case EntityPlayer, EntityNPC:
 		texture = fg.Sprites.PlayerSprites[entity.Direction]
 	case EntityItem:
 		texture = fg.Sprites.ItemSprites[entity.SpriteID]
 	case EntityEnemy:
 		texture = fg.Sprites.EnemySprites[entity.SpriteID]
+	case EntityBlock:
+		texture = fg.Sprites.WallTiles[entity.SpriteID]
+	case EntityPlatform:
+		texture = fg.Sprites.FloorTiles[entity.SpriteID]
+	case EntitySwitch:
+		fg.renderSwitch(entity, screenPos)
+		return
 	default:
 		return
 	}
@@ -150,13 +187,23 @@ func (fg *FilmationGame) RenderEntity(entityID int) {
 	renderY := screenPos.Y - float32(texture.Height)/2
 
 	switch entity.Type {
-	case EntityPlayer, EntityEnemy:
+	case EntityPlayer, EntityEnemy, EntityNPC:
 		renderY -= 8
 	case EntityItem:
 		renderY -= 4
+	case EntityBlock:
+		renderY -= 20
+	case EntityPlatform:
+		renderY += 16
 	}
 
 	color := entity.Color
+	if tint, ok := keyColors[entity.Key]; ok && isKey(entity) && color == rl.White {
+		color = tint
+	}
+	if entity.Type == EntityNPC && color == rl.White {
+		color = npcTint
+	}
 	if entity.Type == EntityEnemy && entity.Health < entity.MaxHealth {
 		color = rl.Color{R: 255, G: 150, B: 150, A: 255}
 	}
@@ -171,31 +218,37 @@ func (fg *FilmationGame) RenderEntity(entityID int) {
 	}
 }
 
-func (fg *FilmationGame) Render() {
-	rl.BeginDrawing()
-	rl.ClearBackground(rl.Color{R: 20, G: 25, B: 35, A: 255})
-
+// renderPlaying draws the room and the HUD.
+func (fg *FilmationGame) renderPlaying() {
 	for _, item := range fg.RenderOrder {
 		if item.Type == "tile" {
 			fg.RenderTile(item.TileData)
 		} else if item.Type == "entity" {
-			fg.RenderEntity(item.EntityID)
+			fg.RenderEntity(item.EntityData)
 		}
 	}
 
 	rl.DrawText("RETROMANSION", 10, 10, 20, rl.White)
-	rl.DrawText("WASD: MOVE | SPACE: ATTACK", 10, 45, 10, rl.LightGray)
+	items := "1"
+	if n := fg.Inventory.hotkeys(); n > 1 {
+		items = fmt.Sprintf("1-%d", n)
+	}
+	help := fmt.Sprintf("%s%s%s%s: MOVE | %s: JUMP | %s: USE | %s: ATTACK | %s: USE ITEM | %s: BAG | F5: SAVE | F9: LOAD | ESC: PAUSE",
+		fg.keyLabel("up"), fg.keyLabel("left"), fg.keyLabel("down"), fg.keyLabel("right"),
+		fg.keyLabel("jump"), fg.keyLabel("use"), fg.keyLabel("attack"), items, fg.keyLabel("bag"))
+	rl.DrawText(help, 10, 45, 10, rl.LightGray)
 
 	rl.DrawText(fmt.Sprintf("HEALTH: %d/%d", fg.Player.Health, fg.Player.MaxHealth), 10, 60, 10, rl.Color{R: 255, G: 100, B: 100, A: 255})
 	rl.DrawText(fmt.Sprintf("ITEMS: %d | Enemies: %d", fg.ItemsCollected, fg.EnemiesKilled), 10, 75, 10, rl.White)
-	rl.DrawText(fmt.Sprintf("POS: (%.0f,%.0f,%.0f)", fg.Player.Position.X, fg.Player.Position.Y, fg.Player.Position.Z), 10, 90, 10, rl.Gray)
+	rl.DrawText(fmt.Sprintf("POS: (%.0f,%.0f,%.0f) | FLOOR: %d", fg.Player.Position.X, fg.Player.Position.Y, fg.Player.Position.Z, fg.Storey()), 10, 90, 10, rl.Gray)
+	rl.DrawText(fmt.Sprintf("KEYS: %s", fg.keyList()), 10, 105, 10, rl.Gold)
+	rl.DrawText(fmt.Sprintf("BAG: %s", fg.inventoryLine()), 10, 120, 10, rl.LightGray)
+	rl.DrawText(fg.equipmentLine(), 10, 135, 10, rl.LightGray)
+	fg.renderObjectives()
 
 	rl.DrawText(fmt.Sprintf("WORLD: %dx%dx%d | RENDERED: %d", fg.World.Width, fg.World.Height, fg.World.Depth, len(fg.RenderOrder)), 10, fg.ScreenH-30, 10, rl.DarkGray)
 
-	if fg.Player.Health <= 0 {
-		rl.DrawRectangle(0, 0, fg.ScreenW, fg.ScreenH, rl.Color{R: 0, G: 0, B: 0, A: 180})
-		rl.DrawText("GAME OVER", fg.ScreenW/2-120, fg.ScreenH/2-20, 36, rl.Color{R: 255, G: 0, B: 0, A: 255})
+	if fg.Dialogue.Open {
+		fg.RenderDialogue()
 	}
-
-	rl.EndDrawing()
 }
@@ -7,11 +7,35 @@ import (
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
+// Room holds a room's state while the player is elsewhere. The room the
+// player is in is played in FilmationGame.World, and is copied back here when
+// they leave, so killed enemies, picked-up items, moved entities and tile
+// changes are all still there when they come back.
 type Room struct {
 	ID          int
 	Name        string
 	World       World3D
 	Connections []RoomConnection
+
+	// Storey is the floor of the mansion the room's lowest storey is on.
+	// See stairs.go.
+	Storey int
+
+	// ResetEnemies brings every enemy back, as it was when the room was
+	// first entered, each time the player comes back into the room.
+	ResetEnemies bool
+
+	// Targets and Wires connect the room's switches to what they work. See
+	// wires.go.
+	Targets []WireTarget
+	Wires   []Wire
+
+	// Script is the path of the room's script, if it has one. See
+	// scripts.go.
+	Script string
+
+	visited bool
+	spawn   []GameEntity
 }
 
 type RoomConnection struct {
@@ -21,6 +45,11 @@ type RoomConnection struct {
 	Direction   Direction
 	RequiresKey bool
 	Active      bool
+
+	// Key names the key a locked door needs. ConsumeKey uses the key up
+	// when the door is unlocked.
+	Key        string
+	ConsumeKey bool
 }
 
 type RoomManager struct {
@@ -102,12 +131,17 @@ func (fg *FilmationGame) AddRoomConnection(fromRoomID, toRoomID int, fromPos, to
 	}
 	room.Connections = append(room.Connections, connection)
 
+	// A connection is drawn as a door, unless it is a flight of stairs. A
+	// door that is already there keeps its state, and a locked door starts
+	// closed.
 	x, y, z := int(fromPos.X), int(fromPos.Y), int(fromPos.Z)
-	if x >= 0 && x < room.World.Width && y >= 0 && y < room.World.Height && z >= 0 && z < room.World.Depth {
+	if x >= 0 && x < room.World.Width && y >= 0 && y < room.World.Height && z >= 0 && z < room.World.Depth &&
+		room.World.Tiles[x][y][z].Type != TileStairs {
+		closed := room.World.isDoor(x, y, z) && room.World.Tiles[x][y][z].Solid
 		room.World.Tiles[x][y][z] = Tile3D{
 			Type:     TileDoor,
 			Position: fromPos,
-			Solid:    false,
+			Solid:    closed || requiresKey,
 			Height:   1.0,
 		}
 	}
@@ -125,7 +159,8 @@ func (fg *FilmationGame) CheckRoomTransitions() {
 		Z: float32(int(fg.Player.Position.Z + 0.5)),
 	}
 
-	for _, connection := range currentRoom.Connections {
+	for i := range currentRoom.Connections {
+		connection := &currentRoom.Connections[i]
 		if !connection.Active {
 			continue
 		}
@@ -134,8 +169,7 @@ func (fg *FilmationGame) CheckRoomTransitions() {
 			playerGridPos.Y == connection.Position.Y &&
 			playerGridPos.Z == connection.Position.Z {
 
-			if connection.RequiresKey && fg.ItemsCollected < 1 {
-				fmt.Println("A key is required to enter this room!")
+			if !fg.Unlock(connection) {
 				return
 			}
 
@@ -154,47 +188,74 @@ func (fg *FilmationGame) TransitionToRoom(roomID int, newPos Point3D, direction
 
 	fmt.Printf("Transitioning to room: %s\n", newRoom.Name)
 
+	fg.storeRoom()
 	fg.Rooms.CurrentRoom = roomID
-	fg.World = newRoom.World
-
-	fg.Player.Position = newPos
-	fg.Player.TargetPosition = newPos
-	fg.Player.IsMoving = false
-	fg.Player.Direction = direction
-	fg.UpdatePlayerBounds()
+	fg.enterRoom()
+	fg.doorSwing = nil
+
+	for _, entity := range fg.Party() {
+		entity.Position = newPos
+		entity.TargetPosition = newPos
+		entity.IsMoving = false
+		entity.VelocityY = 0
+		entity.Direction = direction
+		fg.UpdateEntityBounds(entity)
+	}
 
+	fg.FireHook(HookEnterRoom, nil)
 	fg.CalculateRenderOrder()
+	fg.Autosave()
 }
 
-func (fg *FilmationGame) SetupPlayerInRoom(roomID int, position Point3D) {
-	room := fg.Rooms.Rooms[roomID]
+// storeRoom copies the room being played back into its Room.
+func (fg *FilmationGame) storeRoom() {
+	room := fg.Rooms.Rooms[fg.Rooms.CurrentRoom]
 	if room == nil {
 		return
 	}
 
-	playerEntity := GameEntity{
-		ID:        999,
-		Type:      EntityPlayer,
-		Position:  position,
-		Direction: DirDown,
-		Bounds: BoundingBox3D{
-			Min: Point3D{X: position.X - 0.4, Y: position.Y - 0.4, Z: position.Z - 0.4},
-			Max: Point3D{X: position.X + 0.4, Y: position.Y + 0.4, Z: position.Z + 0.4},
-		},
-		Active:    true,
-		Color:     rl.White,
-		Health:    10,
-		MaxHealth: 10,
-		
-		TargetPosition: position,
-		IsMoving:       false,
-		MoveSpeed:      4.0,
-		MoveTimer:      0.0,
+	room.World = fg.World
+	room.World.Entities = append([]GameEntity(nil), fg.World.Entities...)
+}
+
+// enterRoom starts playing the current room. The first time a room is
+// entered its entities are remembered, so that a room with ResetEnemies can
+// bring its enemies back on later visits.
+func (fg *FilmationGame) enterRoom() {
+	room := fg.Rooms.Rooms[fg.Rooms.CurrentRoom]
+
+	if !room.visited {
+		room.visited = true
+		room.spawn = append([]GameEntity(nil), room.World.Entities...)
+	} else if room.ResetEnemies {
+		var entities []GameEntity
+		for _, entity := range room.World.Entities {
+			if entity.Type != EntityEnemy {
+				entities = append(entities, entity)
+			}
+		}
+		for _, entity := range room.spawn {
+			if entity.Type == EntityEnemy {
+				entities = append(entities, entity)
+			}
+		}
+		room.World.Entities = entities
 	}
 
-	room.World.Entities = append(room.World.Entities, playerEntity)
+	fg.World = room.World
+	fg.World.Entities = append([]GameEntity(nil), room.World.Entities...)
+}
 
-	fg.Player = &room.World.Entities[len(room.World.Entities)-1]
+func (fg *FilmationGame) SetupPlayerInRoom(roomID int, position Point3D) {
+	room := fg.Rooms.Rooms[roomID]
+	if room == nil {
+		return
+	}
+
+	fg.Player = NewPlayer(position)
+	fg.Companions = nil
+	fg.Rooms.CurrentRoom = roomID
+	fg.enterRoom()
 
 	fmt.Printf("Player setup: Health=%d, Position=(%.1f,%.1f,%.1f)\n",
 		fg.Player.Health, fg.Player.Position.X, fg.Player.Position.Y, fg.Player.Position.Z)
@@ -247,8 +308,6 @@ func (fg *FilmationGame) BuildSampleRooms() {
 	startPos := Point3D{X: 5, Y: 1, Z: 8}
 	fg.SetupPlayerInRoom(1, startPos)
 
-	fg.World = room1.World
-
 	fmt.Printf("Built %d rooms, player health: %d\n", len(fg.Rooms.Rooms), fg.Player.Health)
 }
 
@@ -394,7 +453,7 @@ func (fg *FilmationGame) UpdateEnemies() {
 			}
 			
 			if !entity.IsMoving && BoundingBoxesIntersect(entity.Bounds, fg.Player.Bounds) {
-				fg.Player.Health--
+				fg.DamagePlayer(1)
 				fmt.Printf("PLAYER HIT! Health now: %d\n", fg.Player.Health)
 			}
 		}
@@ -0,0 +1,74 @@
+package main
+
+import "testing"
+
+// walkEveryDoor takes the player through every door of a freshly built
+// mansion, the way the game does when they step onto one, and checks that
+// they arrive where the door says, in the room being played and drawn with
+// it.
+func walkEveryDoor(t *testing.T, fg *FilmationGame) {
+	t.Helper()
+	if problems := fg.CheckRooms(); len(problems) > 0 {
+		t.Fatalf("the rooms do not fit together:\n%v", problems)
+	}
+
+	for id := 1; id <= len(fg.Rooms.Rooms); id++ {
+		room := fg.Rooms.Rooms[id]
+		if room == nil {
+			continue
+		}
+		for _, conn := range room.Connections {
+			to := fg.Rooms.Rooms[conn.ToRoomID]
+			if !conn.Active || to == nil {
+				continue
+			}
+
+			fg.TransitionToRoom(id, conn.Position, conn.Direction)
+			fg.Keys = map[string]int{conn.Key: 1}
+			fg.CheckRoomTransitions()
+
+			if fg.Rooms.CurrentRoom != conn.ToRoomID {
+				t.Errorf("room %d %s: door to room %d took the player to room %d", id, formatPoint(conn.Position), conn.ToRoomID, fg.Rooms.CurrentRoom)
+				continue
+			}
+			if fg.Player.Position != conn.ToPosition {
+				t.Errorf("room %d %s: door to room %d left the player at %s instead of %s", id, formatPoint(conn.Position),
+					conn.ToRoomID, formatPoint(fg.Player.Position), formatPoint(conn.ToPosition))
+			}
+			if fg.World.Width != to.World.Width || fg.World.Height != to.World.Height || fg.World.Depth != to.World.Depth {
+				t.Errorf("room %d %s: door to room %d did not start playing that room", id, formatPoint(conn.Position), conn.ToRoomID)
+			}
+			for _, entity := range fg.World.Entities {
+				if entity.Type == EntityPlayer {
+					t.Errorf("room %d %s: door to room %d left a copy of the player in that room", id, formatPoint(conn.Position), conn.ToRoomID)
+				}
+			}
+
+			drawn := false
+			for _, item := range fg.RenderOrder {
+				drawn = drawn || item.EntityData == fg.Player
+			}
+			if !drawn {
+				t.Errorf("room %d %s: door to room %d left the player out of the render order", id, formatPoint(conn.Position), conn.ToRoomID)
+			}
+		}
+	}
+}
+
+func TestWalkEveryDoorMansion(t *testing.T) {
+	fg := &FilmationGame{}
+	if err := fg.LoadLevel("game_assets/levels/mansion.json"); err != nil {
+		t.Fatal(err)
+	}
+	walkEveryDoor(t, fg)
+}
+
+func TestWalkEveryDoorGenerated(t *testing.T) {
+	for seed := int64(1); seed <= 10; seed++ {
+		fg := &FilmationGame{}
+		if err := fg.GenerateMansion(DefaultMansionParams(seed)); err != nil {
+			t.Fatal(err)
+		}
+		walkEveryDoor(t, fg)
+	}
+}
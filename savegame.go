@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Save files hold a game in progress. The mansion is stored as a level, as
+// EncodeLevel writes it, so rooms come back with their tiles, doors and
+// entities as they were left. The rest of the file is the player and what
+// they carry.
+//
+// Entities are written the way level files write them, as the fields that
+// differ from what NewEntity gives. A field added to GameEntity therefore
+// only needs a matching field in LevelEntity: saves written before it existed
+// leave it out, and it keeps its default. Changes that old saves cannot be
+// read through, such as a renamed field, bump SaveFormatVersion and add a
+// migration to saveMigrations.
+
+const SaveFormatVersion = 2
+
+// saveMigrations bring old saves up to date. saveMigrations[i] rewrites a
+// version i+1 save, still as undecoded JSON, into a version i+2 save. Loading
+// runs every migration from the save's version on, so each one only has to
+// know about the version before it.
+var saveMigrations = []func(save map[string]interface{}) error{
+	// Version 2 describes the save in "info", for the slot picker.
+	func(save map[string]interface{}) error {
+		info := map[string]interface{}{"play_time": save["game_time"]}
+		level, _ := save["level"].(map[string]interface{})
+		start, _ := level["start"].(map[string]interface{})
+		rooms, _ := level["rooms"].([]interface{})
+		for _, room := range rooms {
+			room, _ := room.(map[string]interface{})
+			if room["id"] == start["room"] {
+				info["room"] = room["name"]
+			}
+		}
+		save["info"] = info
+		return nil
+	},
+}
+
+type SaveFile struct {
+	Version int       `json:"version"`
+	Info    SaveInfo  `json:"info"`
+	Level   LevelFile `json:"level"`
+
+	// Rooms lists the rooms the player has been in, with the entities each
+	// had when first entered, which rooms that reset their enemies need.
+	Rooms []SaveRoom `json:"rooms,omitempty"`
+
+	Player     LevelEntity   `json:"player"`
+	Companions []LevelEntity `json:"companions,omitempty"`
+
+	Keys      map[string]int `json:"keys,omitempty"`
+	Inventory SaveInventory  `json:"inventory"`
+
+	// Vars are the variables of the level's scripts.
+	Vars map[string]int `json:"vars,omitempty"`
+
+	ItemsCollected int     `json:"items_collected,omitempty"`
+	EnemiesKilled  int     `json:"enemies_killed,omitempty"`
+	GameTime       float32 `json:"game_time,omitempty"`
+	DamageCarry    float32 `json:"damage_carry,omitempty"`
+}
+
+// SaveInfo describes a save without loading it.
+type SaveInfo struct {
+	Room     string    `json:"room"`
+	PlayTime float32   `json:"play_time"`
+	SavedAt  time.Time `json:"saved_at"`
+}
+
+type SaveRoom struct {
+	ID    int           `json:"id"`
+	Spawn []LevelEntity `json:"spawn,omitempty"`
+}
+
+type SaveInventory struct {
+	Capacity int                  `json:"capacity,omitempty"`
+	Stacks   []SaveStack          `json:"stacks,omitempty"`
+	Equipped map[string]SaveStack `json:"equipped,omitempty"`
+}
+
+// SaveStack is an item and how many of it. Items are named by sprite, as in
+// level files, and by sprite ID if the sprite has no name.
+type SaveStack struct {
+	Sprite   string `json:"sprite,omitempty"`
+	SpriteID *int   `json:"sprite_id,omitempty"`
+	Count    int    `json:"count,omitempty"`
+}
+
+// EncodeSave describes the game in progress as a save file.
+func (fg *FilmationGame) EncodeSave() SaveFile {
+	save := SaveFile{
+		Version:        SaveFormatVersion,
+		Info:           SaveInfo{PlayTime: fg.GameTime, SavedAt: time.Now().UTC()},
+		Level:          fg.EncodeLevel(),
+		Keys:           fg.Keys,
+		Vars:           fg.ScriptVars,
+		ItemsCollected: fg.ItemsCollected,
+		EnemiesKilled:  fg.EnemiesKilled,
+		GameTime:       fg.GameTime,
+		DamageCarry:    fg.damageCarry,
+	}
+
+	if room := fg.Rooms.Rooms[fg.Rooms.CurrentRoom]; room != nil {
+		save.Info.Room = room.Name
+	}
+
+	ids := make([]int, 0, len(fg.Rooms.Rooms))
+	for id, room := range fg.Rooms.Rooms {
+		if room.visited {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		saved := SaveRoom{ID: id}
+		for _, entity := range fg.Rooms.Rooms[id].spawn {
+			saved.Spawn = append(saved.Spawn, encodeEntity(entity))
+		}
+		save.Rooms = append(save.Rooms, saved)
+	}
+
+	if fg.Player != nil {
+		save.Player = encodeEntity(*fg.Player)
+	}
+	for _, companion := range fg.Companions {
+		save.Companions = append(save.Companions, encodeEntity(*companion))
+	}
+
+	inv := &fg.Inventory
+	save.Inventory.Capacity = inv.Capacity
+	for _, stack := range inv.Stacks {
+		save.Inventory.Stacks = append(save.Inventory.Stacks, encodeStack(stack.SpriteID, stack.Count))
+	}
+	for slot, spriteID := range inv.Equipped {
+		if save.Inventory.Equipped == nil {
+			save.Inventory.Equipped = make(map[string]SaveStack)
+		}
+		save.Inventory.Equipped[equipSlotNames[slot]] = encodeStack(spriteID, 0)
+	}
+
+	return save
+}
+
+func encodeStack(spriteID, count int) SaveStack {
+	stack := SaveStack{Count: count}
+	if spriteID >= 0 && spriteID < len(itemSpriteNames) {
+		stack.Sprite = itemSpriteNames[spriteID]
+	} else {
+		stack.SpriteID = &spriteID
+	}
+	return stack
+}
+
+// SaveGame writes the game to a file. The file is replaced in one step, so a
+// save that fails part way leaves the old one as it was.
+func (fg *FilmationGame) SaveGame(path string) error {
+	save := fg.EncodeSave()
+	data, err := json.Marshal(&save)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("Saved game to %s\n", path)
+	return nil
+}
+
+// ParseSave reads a save file, migrating it first if it was written by an
+// older version of the game.
+func ParseSave(file string, data []byte) (*SaveFile, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+
+	version, ok := raw["version"].(float64)
+	if !ok || version < 1 || version != float64(int(version)) {
+		return nil, fmt.Errorf("%s: not a save file", file)
+	}
+	if int(version) > SaveFormatVersion {
+		return nil, fmt.Errorf("%s: save version %d is newer than this game (%d)", file, int(version), SaveFormatVersion)
+	}
+
+	for v := int(version); v < SaveFormatVersion; v++ {
+		if err := saveMigrations[v-1](raw); err != nil {
+			return nil, fmt.Errorf("%s: migrating from version %d: %v", file, v, err)
+		}
+		raw["version"] = v + 1
+	}
+
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(migrated))
+	dec.DisallowUnknownFields()
+	save := &SaveFile{}
+	if err := dec.Decode(save); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return save, nil
+}
+
+// LoadGame replaces the game in progress with a saved one. If the save
+// cannot be read, the game carries on as it was.
+func (fg *FilmationGame) LoadGame(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := fg.loadSave(path, data); err != nil {
+		return err
+	}
+	fg.Checkpoint()
+	return nil
+}
+
+// loadSave replaces the game in progress with the save in data, read from
+// file.
+func (fg *FilmationGame) loadSave(path string, data []byte) error {
+	save, err := ParseSave(path, data)
+	if err != nil {
+		return err
+	}
+
+	var errs []string
+	if save.Player.Type != entityTypeNames[EntityPlayer] {
+		errs = append(errs, "player: not a player")
+	}
+	errs = append(errs, savedEntityErrors("player", save.Player)...)
+	for i, def := range save.Companions {
+		errs = append(errs, savedEntityErrors(fmt.Sprintf("companions[%d]", i), def)...)
+	}
+	for i, room := range save.Rooms {
+		for j, def := range room.Spawn {
+			errs = append(errs, savedEntityErrors(fmt.Sprintf("rooms[%d].spawn[%d]", i, j), def)...)
+		}
+	}
+	for i, stack := range save.Inventory.Stacks {
+		if _, ok := stack.spriteID(); !ok {
+			errs = append(errs, fmt.Sprintf("inventory.stacks[%d]: unknown item %q", i, stack.Sprite))
+		}
+	}
+	for name, stack := range save.Inventory.Equipped {
+		if _, ok := parseEquipSlot(name); !ok {
+			errs = append(errs, fmt.Sprintf("inventory.equipped: unknown equipment slot %q", name))
+		}
+		if _, ok := stack.spriteID(); !ok {
+			errs = append(errs, fmt.Sprintf("inventory.equipped.%s: unknown item %q", name, stack.Sprite))
+		}
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("%s:\n%s", path, strings.Join(errs, "\n"))
+	}
+
+	level := &Level{File: path, Data: save.Level}
+	if errs := level.loadScripts(); len(errs) > 0 {
+		return errs
+	}
+	if err := fg.BuildLevel(level); err != nil {
+		return err
+	}
+
+	// BuildLevel starts a new game in the saved room; the rest of the game
+	// comes from the save.
+	for _, saved := range save.Rooms {
+		room := fg.Rooms.Rooms[saved.ID]
+		if room == nil {
+			continue
+		}
+		room.visited = true
+		room.spawn = nil
+		for _, def := range saved.Spawn {
+			room.spawn = append(room.spawn, def.build(0))
+		}
+	}
+
+	player := save.Player.build(0)
+	fg.Player = &player
+	fg.Companions = nil
+	for _, def := range save.Companions {
+		companion := def.build(0)
+		fg.Companions = append(fg.Companions, &companion)
+	}
+
+	fg.Keys = save.Keys
+	fg.Inventory = Inventory{Capacity: save.Inventory.Capacity}
+	for _, stack := range save.Inventory.Stacks {
+		spriteID, _ := stack.spriteID()
+		fg.Inventory.Stacks = append(fg.Inventory.Stacks, InventoryStack{SpriteID: spriteID, Count: stack.Count})
+	}
+	for name, stack := range save.Inventory.Equipped {
+		if fg.Inventory.Equipped == nil {
+			fg.Inventory.Equipped = make(map[EquipSlot]int)
+		}
+		slot, _ := parseEquipSlot(name)
+		fg.Inventory.Equipped[slot], _ = stack.spriteID()
+	}
+
+	fg.ScriptVars = save.Vars
+	fg.ItemsCollected = save.ItemsCollected
+	fg.EnemiesKilled = save.EnemiesKilled
+	fg.GameTime = save.GameTime
+	fg.damageCarry = save.DamageCarry
+	fg.doorSwing = nil
+
+	fg.CalculateRenderOrder()
+	fmt.Printf("Loaded game from %s\n", path)
+	return nil
+}
+
+// savedEntityErrors checks the fields of a saved entity that the level
+// checks would have caught had it been in a room.
+func savedEntityErrors(path string, def LevelEntity) []string {
+	var errs []string
+	if len(def.At) != 3 {
+		errs = append(errs, path+".at: expected [x, y, z]")
+	}
+	if def.Color != nil && len(def.Color) != 4 {
+		errs = append(errs, path+".color: expected [r, g, b, a]")
+	}
+	if def.Target != nil && len(def.Target) != 3 {
+		errs = append(errs, path+".target: expected [x, y, z]")
+	}
+	if def.Bounds != nil && (len(def.Bounds.Min) != 3 || len(def.Bounds.Max) != 3) {
+		errs = append(errs, path+".bounds: expected \"min\" and \"max\" as [x, y, z]")
+	}
+	return errs
+}
+
+func (stack SaveStack) spriteID() (int, bool) {
+	if stack.SpriteID != nil {
+		return *stack.SpriteID, true
+	}
+	return ParseSpriteName(EntityItem, stack.Sprite)
+}
+
+func parseEquipSlot(name string) (EquipSlot, bool) {
+	for slot, n := range equipSlotNames {
+		if n == name {
+			return slot, true
+		}
+	}
+	return SlotNone, false
+}
@@ -0,0 +1,805 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scripts say what happens in a level when things happen in it, without
+// changing the game. A script is a text file of handlers, each a hook, an
+// optional filter, and the commands to run when the hook fires:
+//
+//	on enemy_killed orc
+//	    add orcs 1
+//	    if orcs >= 3
+//	        message "The orcs are beaten. Something unlocks below."
+//	        tile 4 1 0 door
+//	    end
+//	end
+//
+// A level, a room and an entity can each have a script. The level's script
+// hears everything, a room's hears what happens while the player is in the
+// room, and an entity's hears what happens to that entity. Scripts share
+// one set of variables, which are saved with the game. docs/scripting.md
+// describes the language.
+
+type ScriptHook int
+
+const (
+	HookEnterRoom ScriptHook = iota
+	HookPickup
+	HookEnemyKilled
+	HookTick
+)
+
+var scriptHookNames = map[ScriptHook]string{
+	HookEnterRoom:   "enter_room",
+	HookPickup:      "pickup",
+	HookEnemyKilled: "enemy_killed",
+	HookTick:        "tick",
+}
+
+type Script struct {
+	File     string
+	Handlers []ScriptHandler
+
+	// A dialogue has Nodes in place of handlers, and a Speaker, the name
+	// shown over what its NPC says. See dialogue.go.
+	Speaker string
+	Nodes   map[string][]ScriptCommand
+
+	modTime time.Time
+}
+
+// ScriptHandler runs Body when its hook fires and its filter matches. The
+// filter of enter_room is a room ID, that of pickup and enemy_killed a
+// sprite name or entity ID, and that of tick the seconds between runs. An
+// empty filter matches everything, and a tick without one runs every second.
+type ScriptHandler struct {
+	Hook   ScriptHook
+	Filter string
+	Line   int
+	Body   []ScriptCommand
+
+	timer float32
+}
+
+// ScriptCommand is one line of a handler. An if has the commands it guards
+// in Then and Else.
+type ScriptCommand struct {
+	Line int
+	Name string
+	Args []string
+
+	Then, Else []ScriptCommand
+}
+
+// scriptCommands gives the arguments each command takes, one letter per
+// argument: s a quoted string, n a number or variable, v a variable that can
+// be set, e an entity type, p a sprite of that type, t a tile type, r a room
+// ID, d a direction, i an item as parseItemName reads it and w the name of a
+// dialogue node. Arguments after a ? may be left out.
+var scriptCommands = map[string]string{
+	"message": "s",
+	"spawn":   "epnnn",
+	"tile":    "nnnt",
+	"goto":    "rnnn?d",
+	"set":     "vn",
+	"add":     "vn",
+	"give":    "i?n",
+	"take":    "i?n",
+
+	"say":    "s",
+	"choice": "s?w",
+	"jump":   "w",
+}
+
+// dialogueCommands only make sense in dialogues. See dialogue.go.
+var dialogueCommands = map[string]bool{"say": true, "choice": true, "jump": true}
+
+var scriptCompare = map[string]func(a, b int) bool{
+	"==": func(a, b int) bool { return a == b },
+	"!=": func(a, b int) bool { return a != b },
+	"<":  func(a, b int) bool { return a < b },
+	"<=": func(a, b int) bool { return a <= b },
+	">":  func(a, b int) bool { return a > b },
+	">=": func(a, b int) bool { return a >= b },
+}
+
+// scriptBuiltins are values scripts can read but not set.
+var scriptBuiltins = map[string]func(fg *FilmationGame) int{
+	"health": func(fg *FilmationGame) int { return fg.Player.Health },
+	"items":  func(fg *FilmationGame) int { return fg.ItemsCollected },
+	"kills":  func(fg *FilmationGame) int { return fg.EnemiesKilled },
+	"room":   func(fg *FilmationGame) int { return fg.Rooms.CurrentRoom },
+}
+
+type scriptLine struct {
+	no     int
+	fields []string
+}
+
+// readScriptLines splits a script into fields, line by line, leaving out
+// blank lines and comments.
+func readScriptLines(r io.Reader, addf func(line int, format string, args ...interface{})) ([]scriptLine, error) {
+	var lines []scriptLine
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "//") {
+			continue
+		}
+		fields, err := scriptFields(text)
+		if err != nil {
+			addf(lineNo, "%v", err)
+			continue
+		}
+		lines = append(lines, scriptLine{lineNo, fields})
+	}
+	return lines, scanner.Err()
+}
+
+// ParseScript reads a script, reporting every problem with its line.
+func ParseScript(file string, r io.Reader) (*Script, error) {
+	var errs LevelErrors
+	addf := func(line int, format string, args ...interface{}) {
+		errs = append(errs, LevelError{File: file, Line: line, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	lines, err := readScriptLines(r, addf)
+	if err != nil {
+		return nil, err
+	}
+
+	script := &Script{File: file}
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		if line.fields[0] != "on" || len(line.fields) < 2 || len(line.fields) > 3 {
+			addf(line.no, "expected \"on <hook> [filter]\"")
+			i++
+			continue
+		}
+
+		handler := ScriptHandler{Line: line.no}
+		hook, ok := parseScriptHook(line.fields[1])
+		if !ok {
+			addf(line.no, "unknown hook %q (want enter_room, pickup, enemy_killed or tick)", line.fields[1])
+		}
+		handler.Hook = hook
+		if len(line.fields) == 3 {
+			handler.Filter = line.fields[2]
+			if err := checkScriptFilter(hook, handler.Filter); err != nil {
+				addf(line.no, "%v", err)
+			}
+		}
+
+		var end string
+		handler.Body, i, end = parseScriptBlock(lines, i+1, false, addf)
+		switch end {
+		case "":
+			addf(line.no, "\"on %s\" has no \"end\"", line.fields[1])
+		case "else":
+			addf(lines[i-1].no, "\"else\" without \"if\"")
+		}
+		script.Handlers = append(script.Handlers, handler)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return script, nil
+}
+
+// parseScriptBlock reads commands from lines[i] up to an end or else, and
+// returns them, the index after the line that ended them, and which word
+// ended them, or "" if the script ran out first.
+func parseScriptBlock(lines []scriptLine, i int, dialogue bool, addf func(line int, format string, args ...interface{})) ([]ScriptCommand, int, string) {
+	var block []ScriptCommand
+	for i < len(lines) {
+		line := lines[i]
+		name, args := line.fields[0], line.fields[1:]
+		i++
+
+		switch name {
+		case "end", "else":
+			if len(args) > 0 {
+				addf(line.no, "\"%s\" takes no arguments", name)
+			}
+			return block, i, name
+
+		case "on", "node":
+			addf(line.no, "\"%s\" inside a block; is an \"end\" missing?", name)
+			return block, i - 1, "end"
+
+		case "if":
+			cmd := ScriptCommand{Line: line.no, Name: name, Args: args}
+			if err := checkScriptCondition(args); err != nil {
+				addf(line.no, "%v", err)
+			}
+			var end string
+			cmd.Then, i, end = parseScriptBlock(lines, i, dialogue, addf)
+			if end == "else" {
+				cmd.Else, i, end = parseScriptBlock(lines, i, dialogue, addf)
+				if end == "else" {
+					addf(lines[i-1].no, "\"if\" has more than one \"else\"")
+				}
+			}
+			if end == "" {
+				addf(line.no, "\"if\" has no \"end\"")
+			}
+			block = append(block, cmd)
+
+		default:
+			cmd, err := parseScriptCommand(line.no, name, args)
+			if err != nil {
+				addf(line.no, "%v", err)
+			} else if dialogueCommands[name] && !dialogue {
+				addf(line.no, "%s can only be used in a dialogue", name)
+			}
+			block = append(block, cmd)
+		}
+	}
+	return block, i, ""
+}
+
+func parseScriptCommand(line int, name string, args []string) (ScriptCommand, error) {
+	cmd := ScriptCommand{Line: line, Name: name, Args: args}
+	signature, ok := scriptCommands[name]
+	if !ok {
+		return cmd, fmt.Errorf("unknown command %q", name)
+	}
+
+	required, optional, _ := strings.Cut(signature, "?")
+	if len(args) < len(required) || len(args) > len(required)+len(optional) {
+		return cmd, fmt.Errorf("%s takes %s", name, describeScriptSignature(signature))
+	}
+
+	kinds := required + optional
+	var entityType EntityType
+	for i, arg := range args {
+		switch kinds[i] {
+		case 's':
+			text, err := strconv.Unquote(arg)
+			if err != nil || !strings.HasPrefix(arg, "\"") {
+				return cmd, fmt.Errorf("%s expects a quoted string, not %s", name, arg)
+			}
+			cmd.Args[i] = text
+		case 'n':
+			if !isScriptValue(arg) {
+				return cmd, fmt.Errorf("%q is not a number or variable", arg)
+			}
+		case 'v':
+			if !isScriptName(arg) {
+				return cmd, fmt.Errorf("%q is not a variable name", arg)
+			}
+			if _, ok := scriptBuiltins[arg]; ok {
+				return cmd, fmt.Errorf("%s cannot be changed", arg)
+			}
+		case 'e':
+			var ok bool
+			entityType, ok = ParseEntityType(arg)
+			if !ok || entityType == EntityPlayer {
+				return cmd, fmt.Errorf("unknown entity type %q", arg)
+			}
+		case 'p':
+			if _, ok := ParseSpriteName(entityType, arg); !ok {
+				return cmd, fmt.Errorf("unknown %s sprite %q", args[i-1], arg)
+			}
+		case 't':
+			if _, ok := ParseTileType(arg); !ok {
+				return cmd, fmt.Errorf("unknown tile type %q", arg)
+			}
+		case 'r':
+			if _, err := strconv.Atoi(arg); err != nil {
+				return cmd, fmt.Errorf("%q is not a room id", arg)
+			}
+		case 'd':
+			if _, ok := ParseDirection(arg); !ok {
+				return cmd, fmt.Errorf("unknown direction %q", arg)
+			}
+		case 'i':
+			if _, _, ok := parseItemName(arg); !ok {
+				return cmd, fmt.Errorf("unknown item %q", arg)
+			}
+		case 'w':
+			if !isScriptName(arg) {
+				return cmd, fmt.Errorf("%q is not a node name", arg)
+			}
+		}
+	}
+	return cmd, nil
+}
+
+func describeScriptSignature(signature string) string {
+	names := map[rune]string{
+		's': "<text>", 'n': "<value>", 'v': "<variable>", 'e': "<type>",
+		'p': "<sprite>", 't': "<tile>", 'r': "<room>", 'd': "<direction>",
+		'i': "<item>", 'w': "<node>",
+	}
+	var parts []string
+	optional := false
+	for _, kind := range signature {
+		if kind == '?' {
+			optional = true
+			continue
+		}
+		part := names[kind]
+		if optional {
+			part = "[" + part + "]"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
+
+// scriptFields splits a line at spaces, keeping quoted strings whole.
+func scriptFields(text string) ([]string, error) {
+	var fields []string
+	for text = strings.TrimLeft(text, " \t"); text != ""; text = strings.TrimLeft(text, " \t") {
+		if strings.HasPrefix(text, "//") {
+			break
+		}
+		if text[0] == '"' {
+			quoted, err := strconv.QuotedPrefix(text)
+			if err != nil {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			fields = append(fields, quoted)
+			text = text[len(quoted):]
+			continue
+		}
+		end := strings.IndexAny(text, " \t")
+		if end < 0 {
+			end = len(text)
+		}
+		fields = append(fields, text[:end])
+		text = text[end:]
+	}
+	return fields, nil
+}
+
+// checkScriptCondition checks what follows an if: a comparison of two
+// values, or "has" or "lacks" and an item, with an optional count.
+func checkScriptCondition(args []string) error {
+	if len(args) > 0 && (args[0] == "has" || args[0] == "lacks") {
+		if len(args) < 2 || len(args) > 3 {
+			return fmt.Errorf("expected \"if %s <item> [count]\"", args[0])
+		}
+		if _, _, ok := parseItemName(args[1]); !ok {
+			return fmt.Errorf("unknown item %q", args[1])
+		}
+		if len(args) == 3 && !isScriptValue(args[2]) {
+			return fmt.Errorf("%q is not a number or variable", args[2])
+		}
+		return nil
+	}
+
+	if len(args) != 3 || scriptCompare[args[1]] == nil {
+		return fmt.Errorf("expected \"if <value> <==, !=, <, <=, > or >=> <value>\" or \"if has <item>\"")
+	}
+	for _, arg := range []string{args[0], args[2]} {
+		if !isScriptValue(arg) {
+			return fmt.Errorf("%q is not a number or variable", arg)
+		}
+	}
+	return nil
+}
+
+func parseScriptHook(name string) (ScriptHook, bool) {
+	for h, n := range scriptHookNames {
+		if n == name {
+			return h, true
+		}
+	}
+	return HookEnterRoom, false
+}
+
+func checkScriptFilter(hook ScriptHook, filter string) error {
+	switch hook {
+	case HookEnterRoom:
+		if _, err := strconv.Atoi(filter); err != nil {
+			return fmt.Errorf("enter_room takes a room id, not %q", filter)
+		}
+	case HookTick:
+		if seconds, err := parseFloat32(filter); err != nil || seconds <= 0 {
+			return fmt.Errorf("tick takes a number of seconds greater than 0, not %q", filter)
+		}
+	}
+	return nil
+}
+
+func isScriptName(s string) bool {
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		return false
+	}
+	for _, r := range s {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func isScriptValue(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil || isScriptName(s)
+}
+
+// readScript reads a script or dialogue file, remembering when it was last
+// changed so that ReloadScripts can tell when it needs reading again.
+func readScript(path string, dialogue bool) (*Script, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	parse := ParseScript
+	if dialogue {
+		parse = ParseDialogue
+	}
+	script, err := parse(path, f)
+	if err != nil {
+		return nil, err
+	}
+	script.modTime = info.ModTime()
+	return script, nil
+}
+
+// scriptPath turns the path of a script or dialogue in a level file into an
+// absolute one, so that saves, which are elsewhere, still find it.
+func (level *Level) scriptPath(name string) string {
+	if name == "" {
+		return ""
+	}
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(filepath.Dir(level.File), name)
+	}
+	if abs, err := filepath.Abs(name); err == nil {
+		return abs
+	}
+	return name
+}
+
+// loadScripts reads the scripts the level, its rooms and their entities
+// refer to, and the dialogues of its NPCs, and checks that goto commands
+// lead to rooms that exist.
+func (level *Level) loadScripts() LevelErrors {
+	var errs LevelErrors
+	level.Scripts = make(map[string]*Script)
+
+	load := func(path, name string, dialogue bool) {
+		file := level.scriptPath(name)
+		if file == "" {
+			return
+		}
+		if script, ok := level.Scripts[file]; ok {
+			if script != nil && (script.Nodes != nil) != dialogue {
+				errs = append(errs, level.errorf(path, "%s is used both as a script and as a dialogue", name))
+			}
+			return
+		}
+		script, err := readScript(file, dialogue)
+		if err != nil {
+			var scriptErrs LevelErrors
+			if errors.As(err, &scriptErrs) {
+				errs = append(errs, scriptErrs...)
+			} else {
+				errs = append(errs, level.errorf(path, "%v", err))
+			}
+			level.Scripts[file] = nil
+			return
+		}
+		level.Scripts[file] = script
+	}
+
+	load("script", level.Data.Script, false)
+	for i, def := range level.Data.Rooms {
+		load(fmt.Sprintf("rooms[%d].script", i), def.Script, false)
+		for j, entity := range def.Entities {
+			load(fmt.Sprintf("rooms[%d].entities[%d].script", i, j), entity.Script, false)
+			load(fmt.Sprintf("rooms[%d].entities[%d].dialogue", i, j), entity.Dialogue, true)
+		}
+	}
+
+	rooms := make(map[string]bool)
+	for _, def := range level.Data.Rooms {
+		rooms[strconv.Itoa(def.ID)] = true
+	}
+	for _, script := range level.Scripts {
+		if script == nil {
+			continue
+		}
+		checkGoto := func(cmd ScriptCommand) {
+			if cmd.Name == "goto" && !rooms[cmd.Args[0]] {
+				errs = append(errs, LevelError{File: script.File, Line: cmd.Line, Msg: fmt.Sprintf("unknown room id %s", cmd.Args[0])})
+			}
+		}
+		for _, handler := range script.Handlers {
+			walkScript(handler.Body, checkGoto)
+		}
+		for _, node := range script.Nodes {
+			walkScript(node, checkGoto)
+		}
+	}
+	slices.SortStableFunc(errs, func(a, b LevelError) int {
+		return cmp.Or(strings.Compare(a.File, b.File), a.Line-b.Line)
+	})
+	return errs
+}
+
+func walkScript(cmds []ScriptCommand, visit func(cmd ScriptCommand)) {
+	for _, cmd := range cmds {
+		visit(cmd)
+		walkScript(cmd.Then, visit)
+		walkScript(cmd.Else, visit)
+	}
+}
+
+// ReloadScripts reads again any script or dialogue whose file has changed.
+// One with errors is reported and the old one kept, so a typo does not stop
+// the game.
+func (fg *FilmationGame) ReloadScripts() {
+	for path, script := range fg.Scripts {
+		info, err := os.Stat(path)
+		if err != nil || script == nil || !info.ModTime().After(script.modTime) {
+			continue
+		}
+		reloaded, err := readScript(path, script.Nodes != nil)
+		if err != nil {
+			script.modTime = info.ModTime()
+			fmt.Println(err)
+			fg.ShowMessage(fmt.Sprintf("%s has errors, see the console.", filepath.Base(path)))
+			continue
+		}
+		fg.Scripts[path] = reloaded
+		fg.ShowMessage(fmt.Sprintf("Reloaded %s.", filepath.Base(path)))
+	}
+}
+
+// UpdateScripts runs tick handlers and makes any room change a script asked
+// for this frame. It also reloads changed scripts once a second when
+// WatchScripts is set.
+func (fg *FilmationGame) UpdateScripts(deltaTime float32) {
+	if fg.WatchScripts {
+		fg.scriptWatch -= deltaTime
+		if fg.scriptWatch <= 0 {
+			fg.scriptWatch = 1
+			fg.ReloadScripts()
+		}
+	}
+
+	for _, script := range fg.scriptsInScope(nil) {
+		for i := range script.Handlers {
+			handler := &script.Handlers[i]
+			if handler.Hook != HookTick {
+				continue
+			}
+			interval := float32(1)
+			if handler.Filter != "" {
+				interval, _ = parseFloat32(handler.Filter)
+			}
+			handler.timer += deltaTime
+			if handler.timer >= interval {
+				handler.timer -= interval
+				fg.runScript(script.File, handler.Body)
+			}
+		}
+	}
+	fg.finishScripts()
+}
+
+// FireHook runs the handlers for a hook in the level's script, the current
+// room's, and entity's if there is one, whose filters match. The level's
+// objectives hear it first.
+func (fg *FilmationGame) FireHook(hook ScriptHook, entity *GameEntity) {
+	fg.advanceObjectives(hook, entity)
+	for _, script := range fg.scriptsInScope(entity) {
+		for _, handler := range script.Handlers {
+			if handler.Hook == hook && fg.filterMatches(handler, entity) {
+				fg.runScript(script.File, handler.Body)
+			}
+		}
+	}
+}
+
+func (fg *FilmationGame) scriptsInScope(entity *GameEntity) []*Script {
+	var scripts []*Script
+	add := func(path string) {
+		if script := fg.Scripts[path]; script != nil && !slices.Contains(scripts, script) {
+			scripts = append(scripts, script)
+		}
+	}
+	add(fg.LevelScript)
+	if room := fg.Rooms.Rooms[fg.Rooms.CurrentRoom]; room != nil {
+		add(room.Script)
+	}
+	if entity != nil {
+		add(entity.Script)
+	}
+	return scripts
+}
+
+func (fg *FilmationGame) filterMatches(handler ScriptHandler, entity *GameEntity) bool {
+	if handler.Filter == "" {
+		return true
+	}
+	switch handler.Hook {
+	case HookEnterRoom:
+		return handler.Filter == strconv.Itoa(fg.Rooms.CurrentRoom)
+	case HookPickup, HookEnemyKilled:
+		if entity == nil {
+			return false
+		}
+		if id, err := strconv.Atoi(handler.Filter); err == nil {
+			return id == entity.ID
+		}
+		spriteID, ok := ParseSpriteName(entity.Type, handler.Filter)
+		return ok && spriteID == entity.SpriteID
+	}
+	return true
+}
+
+// runScript runs commands from the script or dialogue in file. A jump in a
+// dialogue stops it.
+func (fg *FilmationGame) runScript(file string, cmds []ScriptCommand) {
+	for _, cmd := range cmds {
+		if fg.Dialogue.jump != "" {
+			return
+		}
+
+		args := cmd.Args
+		switch cmd.Name {
+		case "if":
+			if fg.scriptCondition(args) {
+				fg.runScript(file, cmd.Then)
+			} else {
+				fg.runScript(file, cmd.Else)
+			}
+
+		case "message":
+			fg.ShowMessage(fg.interpolate(args[0]))
+
+		case "set", "add":
+			if fg.ScriptVars == nil {
+				fg.ScriptVars = make(map[string]int)
+			}
+			value := fg.scriptValue(args[1])
+			if cmd.Name == "add" {
+				value += fg.ScriptVars[args[0]]
+			}
+			fg.ScriptVars[args[0]] = value
+
+		case "tile":
+			x, y, z := fg.scriptValue(args[0]), fg.scriptValue(args[1]), fg.scriptValue(args[2])
+			if !fg.World.inBounds(x, y, z) {
+				fmt.Printf("%s:%d: tile (%d,%d,%d) is outside the room\n", file, cmd.Line, x, y, z)
+				continue
+			}
+			tileType, _ := ParseTileType(args[3])
+			fg.World.Tiles[x][y][z] = NewTile(tileType, x, y, z)
+
+		case "spawn":
+			x, y, z := fg.scriptValue(args[2]), fg.scriptValue(args[3]), fg.scriptValue(args[4])
+			if !fg.World.inBounds(x, y, z) {
+				fmt.Printf("%s:%d: spawn at (%d,%d,%d) is outside the room\n", file, cmd.Line, x, y, z)
+				continue
+			}
+			entityType, _ := ParseEntityType(args[0])
+			spriteID, _ := ParseSpriteName(entityType, args[1])
+			pos := Point3D{X: float32(x), Y: float32(y), Z: float32(z)}
+			fg.World.Entities = append(fg.World.Entities, NewEntity(fg.nextEntityID(), entityType, pos, spriteID))
+
+		case "goto":
+			// The move waits for the end of the frame, so that the rest of
+			// the handler, and whatever fired it, still happen in the room
+			// they started in.
+			roomID, _ := strconv.Atoi(args[0])
+			direction := fg.Player.Direction
+			if len(args) > 4 {
+				direction, _ = ParseDirection(args[4])
+			}
+			to := Point3D{X: float32(fg.scriptValue(args[1])), Y: float32(fg.scriptValue(args[2])), Z: float32(fg.scriptValue(args[3]))}
+			fg.scriptGoto = func() { fg.TransitionToRoom(roomID, to, direction) }
+
+		case "give", "take":
+			count := 1
+			if len(args) > 1 {
+				count = fg.scriptValue(args[1])
+			}
+			if cmd.Name == "give" {
+				fg.GiveItem(args[0], count)
+			} else {
+				fg.TakeItem(args[0], count)
+			}
+
+		case "say":
+			fg.Dialogue.Lines = append(fg.Dialogue.Lines, fg.interpolate(args[0]))
+
+		case "choice":
+			choice := DialogueChoice{Text: fg.interpolate(args[0])}
+			if len(args) > 1 {
+				choice.Node = args[1]
+			}
+			fg.Dialogue.Choices = append(fg.Dialogue.Choices, choice)
+
+		case "jump":
+			fg.Dialogue.jump = args[0]
+		}
+	}
+}
+
+func (fg *FilmationGame) scriptCondition(args []string) bool {
+	switch args[0] {
+	case "has", "lacks":
+		count := 1
+		if len(args) > 2 {
+			count = fg.scriptValue(args[2])
+		}
+		return (fg.CountItem(args[1]) >= count) == (args[0] == "has")
+	}
+	return scriptCompare[args[1]](fg.scriptValue(args[0]), fg.scriptValue(args[2]))
+}
+
+// finishScripts makes the room change a script asked for.
+func (fg *FilmationGame) finishScripts() {
+	if move := fg.scriptGoto; move != nil {
+		fg.scriptGoto = nil
+		move()
+	}
+}
+
+func (fg *FilmationGame) scriptValue(arg string) int {
+	if n, err := strconv.Atoi(arg); err == nil {
+		return n
+	}
+	if builtin, ok := scriptBuiltins[arg]; ok {
+		return builtin(fg)
+	}
+	return fg.ScriptVars[arg]
+}
+
+// interpolate replaces each {name} in a message with the value of name.
+func (fg *FilmationGame) interpolate(text string) string {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(text, '{')
+		end := strings.IndexByte(text[start+1:], '}')
+		if start < 0 || end < 0 || !isScriptName(text[start+1:start+1+end]) {
+			b.WriteString(text)
+			return b.String()
+		}
+		b.WriteString(text[:start])
+		b.WriteString(strconv.Itoa(fg.scriptValue(text[start+1 : start+1+end])))
+		text = text[start+end+2:]
+	}
+}
+
+// nextEntityID returns an ID no entity in the mansion has.
+func (fg *FilmationGame) nextEntityID() int {
+	next := 0
+	check := func(entities []GameEntity) {
+		for _, entity := range entities {
+			next = max(next, entity.ID+1)
+		}
+	}
+	check(fg.World.Entities)
+	for _, room := range fg.Rooms.Rooms {
+		check(room.World.Entities)
+		check(room.spawn)
+	}
+	return next
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// Games are saved in slots, one file each in FilmationGame.SaveDir. There
+// are SaveSlotCount slots the player saves to, and an autosave slot the game
+// writes every time the player goes through a door.
+
+const SaveSlotCount = 3
+
+const autosaveSlot = "autosave"
+
+// SaveSlot is a slot and what is saved in it.
+type SaveSlot struct {
+	Name string
+	Path string
+
+	// Info describes the save in the slot. It is nil if the slot is empty,
+	// or if the save cannot be read, in which case Err says why.
+	Info *SaveInfo
+	Err  error
+}
+
+// SaveSlots lists the slots, the autosave first.
+func (fg *FilmationGame) SaveSlots() []SaveSlot {
+	names := []string{autosaveSlot}
+	for i := 1; i <= SaveSlotCount; i++ {
+		names = append(names, fmt.Sprintf("slot%d", i))
+	}
+
+	slots := make([]SaveSlot, len(names))
+	for i, name := range names {
+		slots[i] = fg.readSlot(name)
+	}
+	return slots
+}
+
+func (fg *FilmationGame) readSlot(name string) SaveSlot {
+	slot := SaveSlot{Name: name, Path: filepath.Join(fg.SaveDir, name+".json")}
+
+	data, err := os.ReadFile(slot.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return slot
+	}
+	if err != nil {
+		slot.Err = err
+		return slot
+	}
+
+	save, err := ParseSave(slot.Path, data)
+	if err != nil {
+		slot.Err = err
+		return slot
+	}
+	slot.Info = &save.Info
+
+	// Saves from before the time was recorded go by the file's.
+	if slot.Info.SavedAt.IsZero() {
+		if stat, err := os.Stat(slot.Path); err == nil {
+			slot.Info.SavedAt = stat.ModTime()
+		}
+	}
+	return slot
+}
+
+// Label is the slot's name as the player sees it.
+func (slot SaveSlot) Label() string {
+	if slot.Name == autosaveSlot {
+		return "Autosave"
+	}
+	var n int
+	fmt.Sscanf(slot.Name, "slot%d", &n)
+	return fmt.Sprintf("Slot %d", n)
+}
+
+// Summary describes what is in the slot in one line.
+func (slot SaveSlot) Summary() string {
+	switch {
+	case slot.Err != nil:
+		return "(unreadable)"
+	case slot.Info == nil:
+		return "(empty)"
+	}
+	return fmt.Sprintf("%s  %s  %s", slot.Info.Room, formatPlayTime(slot.Info.PlayTime), slot.Info.SavedAt.Local().Format("2006-01-02 15:04"))
+}
+
+func formatPlayTime(seconds float32) string {
+	total := int(seconds)
+	if total >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", total/3600, total/60%60, total%60)
+	}
+	return fmt.Sprintf("%d:%02d", total/60, total%60)
+}
+
+// SaveToSlot saves the game in a slot, making the save directory if needed.
+func (fg *FilmationGame) SaveToSlot(name string) error {
+	if err := os.MkdirAll(fg.SaveDir, 0755); err != nil {
+		return err
+	}
+	return fg.SaveGame(filepath.Join(fg.SaveDir, name+".json"))
+}
+
+// Autosave saves the game in the autosave slot, and makes it the checkpoint
+// to restart from. It only makes the checkpoint if the game has nowhere to
+// save, as when a command loads a mansion to check it.
+func (fg *FilmationGame) Autosave() {
+	fg.Checkpoint()
+	if fg.SaveDir == "" {
+		return
+	}
+	if err := fg.SaveToSlot(autosaveSlot); err != nil {
+		fg.ShowMessage(fmt.Sprintf("Could not autosave: %v", err))
+	}
+}
+
+// writeFileAtomic writes a file so that it is either all there or not
+// changed at all: the data goes to a temporary file beside it, which then
+// replaces it.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// SlotPicker is the list of save slots shown over the game while the player
+// chooses one to save to or load from.
+type SlotPicker struct {
+	Open     bool
+	Saving   bool
+	Selected int
+	Slots    []SaveSlot
+}
+
+// OpenSlotPicker shows the slots, to save to if saving is set and to load
+// from otherwise. The autosave slot can only be loaded from.
+func (fg *FilmationGame) OpenSlotPicker(saving bool) {
+	fg.Picker = SlotPicker{Open: true, Saving: saving, Slots: fg.SaveSlots()}
+	if saving {
+		fg.Picker.Selected = 1
+	}
+}
+
+func (p *SlotPicker) selectable(i int) bool {
+	return !p.Saving || p.Slots[i].Name != autosaveSlot
+}
+
+// HandlePickerInput moves through the slots and saves or loads the chosen
+// one. The key that opened the picker, or backspace, closes it.
+func (fg *FilmationGame) HandlePickerInput() {
+	p := &fg.Picker
+	openKey := int32(rl.KeyF9)
+	if p.Saving {
+		openKey = rl.KeyF5
+	}
+
+	switch {
+	case rl.IsKeyPressed(openKey) || rl.IsKeyPressed(rl.KeyBackspace):
+		p.Open = false
+
+	case rl.IsKeyPressed(rl.KeyUp) || rl.IsKeyPressed(fg.key("up")):
+		for i := p.Selected - 1; i >= 0; i-- {
+			if p.selectable(i) {
+				p.Selected = i
+				break
+			}
+		}
+
+	case rl.IsKeyPressed(rl.KeyDown) || rl.IsKeyPressed(fg.key("down")):
+		if p.Selected+1 < len(p.Slots) {
+			p.Selected++
+		}
+
+	case rl.IsKeyPressed(rl.KeyEnter) || rl.IsKeyPressed(rl.KeySpace):
+		slot := p.Slots[p.Selected]
+		if p.Saving {
+			if err := fg.SaveToSlot(slot.Name); err != nil {
+				fg.ShowMessage(fmt.Sprintf("Could not save: %v", err))
+				return
+			}
+			fg.ShowMessage(fmt.Sprintf("Saved to %s.", slot.Label()))
+		} else {
+			if slot.Info == nil {
+				return
+			}
+			if err := fg.LoadGame(slot.Path); err != nil {
+				fg.ShowMessage(fmt.Sprintf("Could not load: %v", err))
+				return
+			}
+			fg.ShowMessage(fmt.Sprintf("Loaded %s.", slot.Label()))
+			fg.SetState(StatePlaying)
+		}
+		p.Open = false
+		fg.InputDelay = 0.2
+	}
+}
+
+func (fg *FilmationGame) RenderSlotPicker() {
+	p := &fg.Picker
+	width, height := int32(520), int32(60+30*len(p.Slots))
+	x, y := fg.ScreenW/2-width/2, fg.ScreenH/2-height/2
+
+	rl.DrawRectangle(0, 0, fg.ScreenW, fg.ScreenH, rl.Color{R: 0, G: 0, B: 0, A: 150})
+	rl.DrawRectangle(x, y, width, height, rl.Color{R: 30, G: 35, B: 50, A: 240})
+	rl.DrawRectangleLines(x, y, width, height, rl.LightGray)
+
+	title, closeKey := "LOAD GAME", "F9"
+	if p.Saving {
+		title, closeKey = "SAVE GAME", "F5"
+	}
+	rl.DrawText(title, x+15, y+12, 20, rl.White)
+
+	for i, slot := range p.Slots {
+		rowY := y + 45 + int32(i)*30
+		color := rl.LightGray
+		if !p.selectable(i) {
+			color = rl.DarkGray
+		}
+		if i == p.Selected {
+			rl.DrawRectangle(x+8, rowY-5, width-16, 24, rl.Color{R: 70, G: 80, B: 110, A: 255})
+			color = rl.White
+		}
+		rl.DrawText(slot.Label(), x+15, rowY, 10, color)
+		rl.DrawText(slot.Summary(), x+100, rowY, 10, color)
+	}
+
+	rl.DrawText(fmt.Sprintf("UP/DOWN: CHOOSE | ENTER: %s | %s: CANCEL", title[:4], closeKey), x+15, y+height-18, 10, rl.Gray)
+}
@@ -0,0 +1,89 @@
+package main
+
+// A room can have more than one storey. Each storey is two Y levels: its
+// floor, at an even level, and the level above that, where walls and
+// entities stand. Storey 0 has its floor at Y 0 and is stood on at Y 1,
+// storey 1 at Y 2 and 3, and so on.
+//
+// Stairs are tiles at the standing level of a storey. Two stairs tiles, one
+// above the other on neighbouring storeys, are a flight: stepping onto one
+// takes the player to the other. Stairs can also lead to another room, such
+// as one on the floor above, by being the tile of a room connection.
+
+func storeyOf(y float32) int {
+	return int(y) / 2
+}
+
+// StairsDestination reports where the stairs at a cell lead within the
+// room: up if there are stairs two levels above, otherwise down if there are
+// stairs two levels below.
+func (w *World3D) StairsDestination(x, y, z int) (Point3D, bool) {
+	if !w.isStairs(x, y, z) {
+		return Point3D{}, false
+	}
+
+	for _, to := range []int{y + 2, y - 2} {
+		if w.isStairs(x, to, z) {
+			return Point3D{X: float32(x), Y: float32(to), Z: float32(z)}, true
+		}
+	}
+	return Point3D{}, false
+}
+
+func (w *World3D) isStairs(x, y, z int) bool {
+	return x >= 0 && x < w.Width && y >= 0 && y < w.Height && z >= 0 && z < w.Depth &&
+		w.Tiles[x][y][z].Type == TileStairs
+}
+
+// hasStoreyAbove reports whether stairs lead up from the storey stood on at
+// level y.
+func (w *World3D) hasStoreyAbove(y int) bool {
+	if y < 0 || y+2 >= w.Height {
+		return false
+	}
+	for x := 0; x < w.Width; x++ {
+		for z := 0; z < w.Depth; z++ {
+			if to, ok := w.StairsDestination(x, y, z); ok && int(to.Y) > y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CheckStairs takes the player up or down the stairs they have stepped
+// onto. Stairs that lead to another room are left to CheckRoomTransitions.
+func (fg *FilmationGame) CheckStairs() {
+	pos := fg.Player.Position
+	x, y, z := int(pos.X+0.5), int(pos.Y+0.5), int(pos.Z+0.5)
+
+	if room := fg.Rooms.Rooms[fg.Rooms.CurrentRoom]; room != nil {
+		for _, conn := range room.Connections {
+			if conn.Active && conn.Position == (Point3D{X: float32(x), Y: float32(y), Z: float32(z)}) {
+				return
+			}
+		}
+	}
+
+	to, ok := fg.World.StairsDestination(x, y, z)
+	if !ok {
+		return
+	}
+
+	for _, entity := range fg.Party() {
+		entity.Position = to
+		entity.TargetPosition = to
+		entity.IsMoving = false
+		entity.VelocityY = 0
+		fg.UpdateEntityBounds(entity)
+	}
+}
+
+// Storey is the floor of the mansion the player is on.
+func (fg *FilmationGame) Storey() int {
+	storey := storeyOf(fg.Player.Position.Y + 0.5)
+	if room := fg.Rooms.Rooms[fg.Rooms.CurrentRoom]; room != nil {
+		storey += room.Storey
+	}
+	return storey
+}
@@ -0,0 +1,505 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// The game is a stack of states. Only the state on top is updated, so the
+// mansion stands still while the game is paused or over, but every state on
+// the stack is drawn, bottom first, so a pause menu is drawn over the room
+// it paused. The stack always has at least one state; a new one is the
+// title screen.
+
+type GameState int
+
+const (
+	StateTitle GameState = iota
+	StatePlaying
+	StatePaused
+	StateInventory
+	StateGameOver
+	StateVictory
+	StateOptions
+)
+
+// State is the state on top of the stack.
+func (fg *FilmationGame) State() GameState {
+	if len(fg.States) == 0 {
+		return StateTitle
+	}
+	return fg.States[len(fg.States)-1]
+}
+
+// PushState puts a state on top of the stack.
+func (fg *FilmationGame) PushState(state GameState) {
+	fg.States = append(fg.States, state)
+	fg.menuSelected = 0
+}
+
+// PopState goes back to the state under the top one.
+func (fg *FilmationGame) PopState() {
+	if len(fg.States) > 1 {
+		fg.States = fg.States[:len(fg.States)-1]
+	}
+	fg.menuSelected = 0
+	fg.InputDelay = 0.2
+}
+
+// SetState replaces the whole stack with one state.
+func (fg *FilmationGame) SetState(state GameState) {
+	fg.States = []GameState{state}
+	fg.menuSelected = 0
+	fg.InputDelay = 0.2
+}
+
+func (fg *FilmationGame) Update() {
+	if fg.MessageTime > 0 {
+		fg.MessageTime -= rl.GetFrameTime()
+	}
+	if fg.Picker.Open {
+		fg.HandlePickerInput()
+		return
+	}
+
+	switch fg.State() {
+	case StatePlaying:
+		fg.updatePlaying()
+	case StateInventory:
+		fg.updateInventory()
+	default:
+		fg.updateMenu()
+	}
+}
+
+// Render draws the game at ScreenW by ScreenH, scaled up to fill the window
+// as far as it can without changing shape, and centred in it.
+func (fg *FilmationGame) Render() {
+	rl.BeginDrawing()
+	rl.ClearBackground(rl.Color{R: 20, G: 25, B: 35, A: 255})
+	zoom := min(float32(rl.GetScreenWidth())/float32(fg.ScreenW), float32(rl.GetScreenHeight())/float32(fg.ScreenH))
+	if zoom <= 0 {
+		zoom = 1
+	}
+	rl.BeginMode2D(rl.Camera2D{
+		Offset: rl.Vector2{
+			X: (float32(rl.GetScreenWidth()) - float32(fg.ScreenW)*zoom) / 2,
+			Y: (float32(rl.GetScreenHeight()) - float32(fg.ScreenH)*zoom) / 2,
+		},
+		Zoom: zoom,
+	})
+
+	for _, state := range fg.States {
+		switch state {
+		case StateTitle:
+			fg.renderTitle()
+		case StatePlaying:
+			fg.renderPlaying()
+		case StatePaused:
+			fg.renderMenu(state, "PAUSED", rl.White)
+		case StateInventory:
+			fg.renderInventory()
+		case StateGameOver:
+			fg.renderMenu(state, "GAME OVER", rl.Color{R: 255, G: 0, B: 0, A: 255})
+		case StateVictory:
+			fg.renderMenu(state, "VICTORY", rl.Gold)
+		case StateOptions:
+			fg.renderMenu(state, "OPTIONS", rl.White)
+		}
+	}
+	if len(fg.States) == 0 {
+		fg.renderTitle()
+	}
+
+	// A message waits while the dialogue box covers where it goes.
+	if fg.MessageTime > 0 && !fg.Dialogue.Open {
+		width := rl.MeasureText(fg.Message, 20)
+		rl.DrawText(fg.Message, fg.ScreenW/2-width/2, fg.ScreenH-70, 20, rl.White)
+	}
+	if fg.Picker.Open {
+		fg.RenderSlotPicker()
+	}
+
+	rl.EndMode2D()
+	if fg.Config.ShowFPS {
+		rl.DrawFPS(int32(rl.GetScreenWidth())-90, int32(rl.GetScreenHeight())-25)
+	}
+	rl.EndDrawing()
+}
+
+// updatePlaying runs the game for a frame, and moves to another state when
+// the player pauses, opens the bag, dies or wins.
+func (fg *FilmationGame) updatePlaying() {
+	if fg.Dialogue.Open {
+		fg.HandleDialogueInput()
+		return
+	}
+	if rl.IsKeyPressed(rl.KeyEscape) || rl.IsKeyPressed(fg.key("pause")) {
+		fg.PushState(StatePaused)
+		return
+	}
+	if rl.IsKeyPressed(fg.key("bag")) || rl.IsKeyPressed(rl.KeyTab) {
+		fg.PushState(StateInventory)
+		return
+	}
+
+	fg.GameTime += rl.GetFrameTime()
+	fg.AnimTime += rl.GetFrameTime()
+
+	fg.HandleInput()
+	fg.UpdateDoors(rl.GetFrameTime())
+	fg.UpdateMovement()
+	fg.UpdateSwitches(rl.GetFrameTime())
+	fg.UpdateEnemies()
+	fg.UpdateScripts(rl.GetFrameTime())
+	fg.UpdateObjectives()
+	fg.CalculateRenderOrder()
+
+	switch {
+	case fg.Player.Health <= 0:
+		fg.PushState(StateGameOver)
+	case fg.Won:
+		fg.PushState(StateVictory)
+	}
+}
+
+// menuItem is one line of a menu. A disabled item is shown but cannot be
+// chosen. An item with adjust is a setting that left and right change.
+type menuItem struct {
+	label    string
+	disabled bool
+	choose   func()
+	adjust   func(step int)
+}
+
+// menu gives the items of the menu the state on top shows.
+func (fg *FilmationGame) menu() []menuItem {
+	load := menuItem{label: "LOAD GAME", disabled: !fg.hasSaves(), choose: func() { fg.OpenSlotPicker(false) }}
+	title := menuItem{label: "QUIT TO TITLE", choose: func() { fg.SetState(StateTitle) }}
+	quit := menuItem{label: "QUIT", choose: func() { fg.Quit = true }}
+	options := menuItem{label: "OPTIONS", choose: func() { fg.PushState(StateOptions) }}
+
+	switch fg.State() {
+	case StateTitle:
+		autosave := filepath.Join(fg.SaveDir, autosaveSlot+".json")
+		return []menuItem{
+			{label: "CONTINUE", disabled: fg.SaveDir == "" || !fileExists(autosave), choose: func() { fg.loadAndPlay(autosave) }},
+			{label: "NEW GAME", choose: func() {
+				fg.NewGame()
+				fg.SetState(StatePlaying)
+			}},
+			load,
+			options,
+			quit,
+		}
+	case StatePaused:
+		return []menuItem{
+			{label: "RESUME", choose: fg.PopState},
+			{label: "SAVE GAME", choose: func() { fg.OpenSlotPicker(true) }},
+			load,
+			options,
+			title,
+		}
+	case StateGameOver:
+		return []menuItem{
+			{label: "RESTART FROM CHECKPOINT", choose: fg.RestartFromCheckpoint},
+			load,
+			title,
+			quit,
+		}
+	case StateVictory:
+		return []menuItem{
+			{label: "NEW GAME", choose: func() {
+				fg.NewGame()
+				fg.SetState(StatePlaying)
+			}},
+			load,
+			title,
+			quit,
+		}
+	case StateOptions:
+		return fg.optionsMenu()
+	}
+	return nil
+}
+
+// updateMenu moves through the menu of the state on top and chooses from
+// it. Escape closes the pause and options menus.
+func (fg *FilmationGame) updateMenu() {
+	if fg.InputDelay > 0 {
+		fg.InputDelay -= rl.GetFrameTime()
+		return
+	}
+	if fg.rebinding != "" {
+		fg.rebind()
+		return
+	}
+	switch {
+	case fg.State() == StatePaused && (rl.IsKeyPressed(rl.KeyEscape) || rl.IsKeyPressed(fg.key("pause"))):
+		fg.PopState()
+		return
+	case fg.State() == StateOptions && (rl.IsKeyPressed(rl.KeyEscape) || rl.IsKeyPressed(rl.KeyBackspace)):
+		fg.PopState()
+		return
+	}
+
+	items := fg.menu()
+	if fg.menuSelected >= len(items) || items[fg.menuSelected].disabled {
+		fg.menuSelected = nextMenuItem(items, -1, 1)
+	}
+
+	switch {
+	case rl.IsKeyPressed(rl.KeyUp) || rl.IsKeyPressed(fg.key("up")):
+		fg.menuSelected = nextMenuItem(items, fg.menuSelected, -1)
+	case rl.IsKeyPressed(rl.KeyDown) || rl.IsKeyPressed(fg.key("down")):
+		fg.menuSelected = nextMenuItem(items, fg.menuSelected, 1)
+	case rl.IsKeyPressed(rl.KeyLeft) || rl.IsKeyPressed(rl.KeyRight):
+		step := 1
+		if rl.IsKeyPressed(rl.KeyLeft) {
+			step = -1
+		}
+		if item := items[fg.menuSelected]; !item.disabled && item.adjust != nil {
+			item.adjust(step)
+		}
+	case rl.IsKeyPressed(rl.KeyEnter) || rl.IsKeyPressed(rl.KeySpace):
+		if item := items[fg.menuSelected]; !item.disabled {
+			item.choose()
+		}
+	}
+}
+
+// nextMenuItem returns the first item that can be chosen after from, going
+// by step, or from itself if there is none.
+func nextMenuItem(items []menuItem, from, step int) int {
+	for i := from + step; i >= 0 && i < len(items); i += step {
+		if !items[i].disabled {
+			return i
+		}
+	}
+	return max(from, 0)
+}
+
+// renderMenu draws a state over what is under it: a title, and the menu if
+// the state is on top. A menu under the options menu is hidden by it.
+func (fg *FilmationGame) renderMenu(state GameState, title string, color rl.Color) {
+	if state != fg.State() && fg.State() == StateOptions {
+		return
+	}
+	rl.DrawRectangle(0, 0, fg.ScreenW, fg.ScreenH, rl.Color{R: 0, G: 0, B: 0, A: 180})
+	width := rl.MeasureText(title, 36)
+	rl.DrawText(title, fg.ScreenW/2-width/2, fg.ScreenH/2-100, 36, color)
+
+	if state == StateVictory || state == StateGameOver {
+		stats := fmt.Sprintf("TIME %s | ITEMS %d | ENEMIES %d", formatPlayTime(fg.GameTime), fg.ItemsCollected, fg.EnemiesKilled)
+		width = rl.MeasureText(stats, 10)
+		rl.DrawText(stats, fg.ScreenW/2-width/2, fg.ScreenH/2-55, 10, rl.LightGray)
+	}
+	if state == fg.State() {
+		fg.renderMenuItems(fg.ScreenH/2 - 20)
+	}
+	if state == StateOptions {
+		hint := "UP/DOWN: CHOOSE | LEFT/RIGHT: CHANGE | ENTER: SELECT | ESC: BACK"
+		width = rl.MeasureText(hint, 10)
+		rl.DrawText(hint, fg.ScreenW/2-width/2, fg.ScreenH-30, 10, rl.Gray)
+	}
+}
+
+// renderMenuItems draws the items of the menu on top, centred, from y down.
+// A long menu, like the options, is drawn smaller and starts higher to fit.
+func (fg *FilmationGame) renderMenuItems(y int32) {
+	items := fg.menu()
+	size, spacing := int32(16), int32(32)
+	if len(items) > 8 {
+		size, spacing = 10, 18
+		y -= 40
+	}
+	for i, item := range items {
+		color := rl.LightGray
+		if item.disabled {
+			color = rl.DarkGray
+		}
+		if i == fg.menuSelected && !item.disabled {
+			rl.DrawRectangle(fg.ScreenW/2-130, y-5, 260, size+10, rl.Color{R: 70, G: 80, B: 110, A: 255})
+			color = rl.White
+		}
+		width := rl.MeasureText(item.label, size)
+		rl.DrawText(item.label, fg.ScreenW/2-width/2, y, size, color)
+		y += spacing
+	}
+}
+
+func (fg *FilmationGame) renderTitle() {
+	rl.ClearBackground(rl.Color{R: 20, G: 25, B: 35, A: 255})
+	if fg.State() != StateTitle {
+		return
+	}
+	title := "RETROMANSION"
+	width := rl.MeasureText(title, 48)
+	rl.DrawText(title, fg.ScreenW/2-width/2, fg.ScreenH/4, 48, rl.Gold)
+	fg.renderMenuItems(fg.ScreenH / 2)
+	hint := "UP/DOWN: CHOOSE | ENTER: SELECT"
+	width = rl.MeasureText(hint, 10)
+	rl.DrawText(hint, fg.ScreenW/2-width/2, fg.ScreenH-30, 10, rl.Gray)
+}
+
+// updateInventory moves through the bag and uses the chosen item. The bag
+// key, Tab or Escape go back to the game.
+func (fg *FilmationGame) updateInventory() {
+	if fg.InputDelay > 0 {
+		fg.InputDelay -= rl.GetFrameTime()
+		return
+	}
+	stacks := len(fg.Inventory.Stacks)
+	switch {
+	case rl.IsKeyPressed(fg.key("bag")) || rl.IsKeyPressed(rl.KeyTab) || rl.IsKeyPressed(rl.KeyEscape):
+		fg.PopState()
+	case rl.IsKeyPressed(rl.KeyUp) || rl.IsKeyPressed(fg.key("up")):
+		fg.menuSelected = max(fg.menuSelected-1, 0)
+	case rl.IsKeyPressed(rl.KeyDown) || rl.IsKeyPressed(fg.key("down")):
+		fg.menuSelected = max(min(fg.menuSelected+1, stacks-1), 0)
+	case rl.IsKeyPressed(rl.KeyEnter) || rl.IsKeyPressed(rl.KeySpace):
+		fg.UseItem(fg.menuSelected)
+		fg.menuSelected = max(min(fg.menuSelected, len(fg.Inventory.Stacks)-1), 0)
+	}
+}
+
+func (fg *FilmationGame) renderInventory() {
+	inv := &fg.Inventory
+	width, height := int32(420), int32(110+22*inv.capacity())
+	x, y := fg.ScreenW/2-width/2, fg.ScreenH/2-height/2
+
+	rl.DrawRectangle(0, 0, fg.ScreenW, fg.ScreenH, rl.Color{R: 0, G: 0, B: 0, A: 150})
+	rl.DrawRectangle(x, y, width, height, rl.Color{R: 30, G: 35, B: 50, A: 240})
+	rl.DrawRectangleLines(x, y, width, height, rl.LightGray)
+	rl.DrawText("BAG", x+15, y+12, 20, rl.White)
+
+	for i := range inv.capacity() {
+		rowY := y + 45 + int32(i)*22
+		if i >= len(inv.Stacks) {
+			rl.DrawText(fmt.Sprintf("%d. -", i+1), x+15, rowY, 10, rl.DarkGray)
+			continue
+		}
+		stack := inv.Stacks[i]
+		color := rl.LightGray
+		if i == fg.menuSelected {
+			rl.DrawRectangle(x+8, rowY-5, width-16, 20, rl.Color{R: 70, G: 80, B: 110, A: 255})
+			color = rl.White
+		}
+		def := itemDef(stack.SpriteID)
+		name := fmt.Sprintf("%d. %s", i+1, def.Name)
+		if stack.Count > 1 {
+			name += fmt.Sprintf(" x%d", stack.Count)
+		}
+		rl.DrawText(name, x+15, rowY, 10, color)
+		rl.DrawText(describeItem(def), x+170, rowY, 10, color)
+	}
+
+	footY := y + 45 + int32(inv.capacity())*22
+	rl.DrawText(strings.ToUpper(fg.equipmentLine()), x+15, footY+5, 10, rl.LightGray)
+	rl.DrawText(fmt.Sprintf("KEYS: %s", fg.keyList()), x+15, footY+20, 10, rl.Gold)
+	rl.DrawText(fmt.Sprintf("UP/DOWN: CHOOSE | ENTER: USE | %s: CLOSE", fg.keyLabel("bag")), x+15, y+height-18, 10, rl.Gray)
+}
+
+// describeItem says what an item does, for the bag.
+func describeItem(def ItemDef) string {
+	switch {
+	case def.Heal > 0:
+		return fmt.Sprintf("restores %d health", def.Heal)
+	case def.Attack > 0:
+		return fmt.Sprintf("%s, +%d attack", equipSlotNames[def.Slot], def.Attack)
+	case def.Defense > 0:
+		return fmt.Sprintf("%s, blocks %.0f%%", equipSlotNames[def.Slot], def.Defense*100)
+	}
+	return ""
+}
+
+// NewGame starts the mansion from the beginning: the level, or the
+// generated mansion if there is a seed, with the player carrying nothing.
+// A level that cannot be loaded falls back to the built-in sample rooms.
+func (fg *FilmationGame) NewGame() {
+	fg.Keys = nil
+	fg.Inventory = Inventory{}
+	fg.ItemsCollected = 0
+	fg.EnemiesKilled = 0
+	fg.GameTime = 0
+	fg.damageCarry = 0
+	fg.doorSwing = nil
+	fg.Dialogue = DialogueBox{}
+	fg.Scripts, fg.LevelScript, fg.ScriptVars = nil, "", nil
+	fg.Objectives, fg.Won = nil, false
+
+	var err error
+	if fg.Generate {
+		err = fg.GenerateMansion(DefaultMansionParams(fg.Seed))
+	} else {
+		err = fg.LoadLevel(fg.LevelPath)
+	}
+	if err != nil {
+		fmt.Printf("Failed to load level:\n%v\n", err)
+		fmt.Println("Falling back to the built-in sample rooms")
+		fg.BuildSampleRooms()
+	}
+	fg.CalculateRenderOrder()
+	fg.Checkpoint()
+}
+
+// Checkpoint remembers the game as it is now, to restart from if the player
+// dies. The game makes one when it starts or is loaded, and whenever it
+// autosaves.
+func (fg *FilmationGame) Checkpoint() {
+	save := fg.EncodeSave()
+	data, err := json.Marshal(&save)
+	if err != nil {
+		fmt.Printf("Could not make a checkpoint: %v\n", err)
+		return
+	}
+	fg.checkpoint = data
+}
+
+// RestartFromCheckpoint puts the game back as it was at the last
+// checkpoint, or starts it again if there is none.
+func (fg *FilmationGame) RestartFromCheckpoint() {
+	if fg.checkpoint == nil {
+		fg.NewGame()
+	} else if err := fg.loadSave("checkpoint", fg.checkpoint); err != nil {
+		fg.ShowMessage(fmt.Sprintf("Could not restart: %v", err))
+		return
+	}
+	fg.SetState(StatePlaying)
+}
+
+// loadAndPlay loads a saved game and plays it.
+func (fg *FilmationGame) loadAndPlay(path string) {
+	if err := fg.LoadGame(path); err != nil {
+		fg.ShowMessage(fmt.Sprintf("Could not load: %v", err))
+		return
+	}
+	fg.SetState(StatePlaying)
+}
+
+// hasSaves reports whether any slot has a file in it. Menus ask every
+// frame, so it only looks for the files rather than reading them.
+func (fg *FilmationGame) hasSaves() bool {
+	if fg.SaveDir == "" {
+		return false
+	}
+	if fileExists(filepath.Join(fg.SaveDir, autosaveSlot+".json")) {
+		return true
+	}
+	for i := 1; i <= SaveSlotCount; i++ {
+		if fileExists(filepath.Join(fg.SaveDir, fmt.Sprintf("slot%d.json", i))) {
+			return true
+		}
+	}
+	return false
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
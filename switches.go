@@ -0,0 +1,130 @@
+package main
+
+import (
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// Switches are entities that wires listen to. A switch's sprite says what
+// kind it is:
+//
+//   - A lever is pulled with the interact key, and stays where it is put.
+//   - A pressure plate is on while anything stands in its bounds: the
+//     player, a companion, an enemy, an NPC or a block.
+//   - A floor switch turns on the first time anything steps into its bounds,
+//     and stays on.
+//
+// A switch's bounds are the region it watches, so a plate can be made to
+// cover more than its own cell by giving it larger bounds.
+
+const (
+	switchLever = iota
+	switchPlate
+	switchFloor
+)
+
+var switchSpriteNames = []string{"lever", "plate", "floor"}
+
+// UpdateSwitches works out which plates and floor switches are pressed, then
+// passes the room's switches on through its wires. It draws nothing, so it
+// can be run without a window.
+func (fg *FilmationGame) UpdateSwitches(deltaTime float32) {
+	for i := range fg.World.Entities {
+		s := &fg.World.Entities[i]
+		if !s.Active || s.Type != EntitySwitch {
+			continue
+		}
+		switch s.SpriteID {
+		case switchPlate:
+			s.On = fg.pressed(s)
+		case switchFloor:
+			s.On = s.On || fg.pressed(s)
+		}
+	}
+
+	if room := fg.Rooms.Rooms[fg.Rooms.CurrentRoom]; room != nil {
+		for i := range room.Wires {
+			fg.updateWire(&room.Wires[i], deltaTime)
+		}
+	}
+}
+
+// pressed reports whether anything heavy is inside a switch's bounds.
+func (fg *FilmationGame) pressed(s *GameEntity) bool {
+	for i := range fg.World.Entities {
+		entity := &fg.World.Entities[i]
+		if entity.Active && fallsWithGravity(entity) && BoundingBoxesIntersect(s.Bounds, entity.Bounds) {
+			return true
+		}
+	}
+	for _, entity := range fg.Party() {
+		if BoundingBoxesIntersect(s.Bounds, entity.Bounds) {
+			return true
+		}
+	}
+	return false
+}
+
+// switchOn reports whether the switch with the given ID in the room being
+// played is on.
+func (fg *FilmationGame) switchOn(id int) bool {
+	for i := range fg.World.Entities {
+		if s := &fg.World.Entities[i]; s.ID == id && s.Type == EntitySwitch {
+			return s.Active && s.On
+		}
+	}
+	return false
+}
+
+// leverAt returns the lever in the cell at pos, or nil if there is none.
+func (fg *FilmationGame) leverAt(pos Point3D) *GameEntity {
+	cell := cellOf(pos)
+	for i := range fg.World.Entities {
+		s := &fg.World.Entities[i]
+		if s.Active && s.Type == EntitySwitch && s.SpriteID == switchLever && cellOf(s.Position) == cell {
+			return s
+		}
+	}
+	return nil
+}
+
+// Interact talks to the NPC the player is facing, pulls the lever they are
+// standing at or facing, or else opens or closes the door they are facing.
+func (fg *FilmationGame) Interact() {
+	if npc := fg.npcInFront(); npc != nil {
+		fg.Talk(npc)
+		return
+	}
+	if lever := fg.leverAt(fg.Player.Position); lever != nil {
+		lever.On = !lever.On
+		return
+	}
+	front := inFront(fg.Player)
+	if lever := fg.leverAt(front); lever != nil {
+		lever.On = !lever.On
+		return
+	}
+	fg.ToggleDoor(front)
+}
+
+// renderSwitch draws a switch as a disc on the floor, green when it is on
+// and red when it is off. A lever also has a handle, leaning right when on.
+func (fg *FilmationGame) renderSwitch(entity *GameEntity, screenPos Point2D) {
+	color := rl.Color{R: 170, G: 50, B: 50, A: 255}
+	if entity.On {
+		color = rl.Color{R: 60, G: 190, B: 80, A: 255}
+	}
+
+	x, y := int32(screenPos.X), int32(screenPos.Y+8)
+	rl.DrawEllipse(x, y, 10, 5, rl.DarkGray)
+	rl.DrawEllipse(x, y, 7, 3.5, color)
+
+	if entity.SpriteID == switchLever {
+		lean := float32(-7)
+		if entity.On {
+			lean = 7
+		}
+		tip := rl.Vector2{X: screenPos.X + lean, Y: screenPos.Y - 8}
+		rl.DrawLineEx(rl.Vector2{X: screenPos.X, Y: screenPos.Y + 8}, tip, 2, rl.LightGray)
+		rl.DrawCircleV(tip, 3, color)
+	}
+}
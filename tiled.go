@@ -0,0 +1,846 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Maps made in the Tiled editor (https://www.mapeditor.org) can be imported
+// as rooms. The conventions are documented in docs/tiled.md.
+
+const tiledGIDMask = 0x1fffffff
+
+type tiledMap struct {
+	file       string
+	width      int
+	height     int
+	tileWidth  float64
+	tileHeight float64
+	props      map[string]string
+	tilesets   []tiledTileset
+	layers     []tiledLayer
+}
+
+type tiledTileset struct {
+	firstGID int
+	tiles    map[int]tiledTile
+}
+
+type tiledTile struct {
+	class string
+	props map[string]string
+}
+
+type tiledLayer struct {
+	name    string
+	objects bool
+	props   map[string]string
+	data    []uint32
+	items   []tiledObject
+}
+
+type tiledObject struct {
+	id    int
+	name  string
+	class string
+	x, y  float64
+	w, h  float64
+	gid   uint32
+	props map[string]string
+}
+
+// ImportTiled converts Tiled maps into a level. Each path may be a map
+// (.tmx, .tmj or .json), a Tiled world file (.world) listing maps, or a
+// directory whose maps are all imported. Every map becomes one room.
+func ImportTiled(paths ...string) (*Level, error) {
+	var files []string
+	for _, path := range paths {
+		found, err := tiledMapFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, found...)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no Tiled maps found in %s", strings.Join(paths, ", "))
+	}
+
+	level := &Level{
+		File: strings.Join(paths, ", "),
+		Data: LevelFile{Version: LevelFormatVersion},
+	}
+
+	var errs LevelErrors
+	haveStart := false
+	for _, file := range files {
+		m, err := readTiledMap(file)
+		if err != nil {
+			errs = append(errs, LevelError{File: file, Msg: err.Error()})
+			continue
+		}
+
+		room, start, roomErrs := m.toRoom()
+		errs = append(errs, roomErrs...)
+		if len(roomErrs) > 0 {
+			continue
+		}
+		level.Data.Rooms = append(level.Data.Rooms, room)
+
+		if start != nil {
+			if haveStart {
+				errs = append(errs, LevelError{File: file, Msg: "more than one map has a start object"})
+			}
+			level.Data.Start = *start
+			haveStart = true
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	sort.Slice(level.Data.Rooms, func(i, j int) bool { return level.Data.Rooms[i].ID < level.Data.Rooms[j].ID })
+
+	if !haveStart {
+		first := level.Data.Rooms[0]
+		level.Data.Start = LevelStart{
+			Room:     first.ID,
+			Position: []float32{float32(first.Size[0] / 2), 1, float32(first.Size[2] / 2)},
+		}
+	}
+
+	if errs := level.Validate(); len(errs) > 0 {
+		return nil, errs
+	}
+	return level, nil
+}
+
+func (fg *FilmationGame) LoadTiled(paths ...string) error {
+	fmt.Printf("Importing Tiled maps: %s\n", strings.Join(paths, ", "))
+
+	level, err := ImportTiled(paths...)
+	if err != nil {
+		return err
+	}
+	return fg.BuildLevel(level)
+}
+
+// isTiledPath reports whether LoadLevel should import path from Tiled: a
+// directory, a .tmx, .tmj or .world file, or a .json file holding a Tiled
+// map rather than a level.
+func isTiledPath(path string) bool {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return true
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".tmx", ".tmj", ".world":
+		return true
+	case ".json":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return false
+		}
+		var doc struct {
+			Type string `json:"type"`
+		}
+		return json.Unmarshal(data, &doc) == nil && doc.Type == "map"
+	}
+	return false
+}
+
+func tiledMapFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		var files []string
+		for _, entry := range entries {
+			switch strings.ToLower(filepath.Ext(entry.Name())) {
+			case ".tmx", ".tmj":
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+		return files, nil
+	}
+
+	if strings.ToLower(filepath.Ext(path)) != ".world" {
+		return []string{path}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var world struct {
+		Maps []struct {
+			FileName string `json:"fileName"`
+		} `json:"maps"`
+	}
+	if err := json.Unmarshal(data, &world); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	var files []string
+	for _, m := range world.Maps {
+		files = append(files, filepath.Join(filepath.Dir(path), m.FileName))
+	}
+	return files, nil
+}
+
+func (m *tiledMap) toRoom() (LevelRoom, *LevelStart, LevelErrors) {
+	var errs LevelErrors
+	addf := func(format string, args ...interface{}) {
+		errs = append(errs, LevelError{File: m.file, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	room := LevelRoom{Name: m.props["name"]}
+	if room.Name == "" {
+		room.Name = strings.TrimSuffix(filepath.Base(m.file), filepath.Ext(m.file))
+	}
+
+	id, err := strconv.Atoi(m.props["room_id"])
+	if err != nil {
+		addf("map needs an integer \"room_id\" property")
+	}
+	room.ID = id
+
+	height := 0
+	tileLayers := 0
+	layerY := make([]int, len(m.layers))
+	for i, layer := range m.layers {
+		defaultY := 1
+		if !layer.objects {
+			defaultY = tileLayers
+			tileLayers++
+		}
+		y, err := propInt(layer.props, "y", defaultY)
+		if err != nil {
+			addf("layer %q: %v", layer.name, err)
+		}
+		layerY[i] = y
+		if !layer.objects {
+			height = max(height, y+1)
+		}
+	}
+	if h, ok := m.props["height"]; ok {
+		height, err = strconv.Atoi(h)
+		if err != nil {
+			addf("map property \"height\": %v", err)
+		}
+	}
+	room.Size = []int{m.width, max(height, 1), m.height}
+	if value, ok := m.props["storey"]; ok {
+		room.Storey, err = strconv.Atoi(value)
+		if err != nil {
+			addf("map property \"storey\": %v", err)
+		}
+	}
+	if value, ok := m.props["reset_enemies"]; ok {
+		room.ResetEnemies, err = strconv.ParseBool(value)
+		if err != nil {
+			addf("map property \"reset_enemies\": %v", err)
+		}
+	}
+
+	var start *LevelStart
+	for i, layer := range m.layers {
+		y := layerY[i]
+
+		if !layer.objects {
+			levelLayer := LevelLayer{Y: y}
+			for index, gid := range layer.data {
+				gid &= tiledGIDMask
+				if gid == 0 {
+					continue
+				}
+				x, z := index%m.width, index/m.width
+				tile, err := m.tileDef(gid)
+				if err != nil {
+					addf("layer %q, tile (%d,%d): %v", layer.name, x, z, err)
+					continue
+				}
+				tile.At = []int{x, z}
+				levelLayer.Tiles = append(levelLayer.Tiles, tile)
+			}
+			if len(levelLayer.Tiles) > 0 {
+				room.Layers = append(room.Layers, levelLayer)
+			}
+			continue
+		}
+
+		for _, obj := range layer.items {
+			where := fmt.Sprintf("layer %q, object %d", layer.name, obj.id)
+			objY, err := propInt(obj.props, "y", y)
+			if err != nil {
+				addf("%s: %v", where, err)
+				continue
+			}
+			x, z := m.objectCell(obj)
+			at := []float32{float32(x), float32(objY), float32(z)}
+
+			class := obj.class
+			if class == "" && obj.gid != 0 {
+				if tile, ok := m.tile(obj.gid & tiledGIDMask); ok {
+					class = tile.class
+				}
+			}
+
+			switch class {
+			case "start":
+				start = &LevelStart{Room: room.ID, Position: at}
+			case "door":
+				conn, err := tiledConnection(obj.props)
+				if err != nil {
+					addf("%s: %v", where, err)
+					continue
+				}
+				conn.At = at
+				room.Connections = append(room.Connections, conn)
+			case "item", "enemy", "npc", "effect", "block", "platform", "switch":
+				entity, err := tiledEntity(class, obj)
+				if err != nil {
+					addf("%s: %v", where, err)
+					continue
+				}
+				entity.At = at
+				room.Entities = append(room.Entities, entity)
+			default:
+				addf("%s: unknown object class %q (want start, door, item, enemy, npc, effect, block, platform or switch)", where, class)
+			}
+		}
+	}
+
+	return room, start, errs
+}
+
+func (m *tiledMap) tile(gid uint32) (tiledTile, bool) {
+	for i := len(m.tilesets) - 1; i >= 0; i-- {
+		ts := m.tilesets[i]
+		if int(gid) >= ts.firstGID {
+			tile, ok := ts.tiles[int(gid)-ts.firstGID]
+			return tile, ok
+		}
+	}
+	return tiledTile{}, false
+}
+
+func (m *tiledMap) tileDef(gid uint32) (LevelTile, error) {
+	var def LevelTile
+	tile, ok := m.tile(gid)
+	if !ok {
+		return def, fmt.Errorf("tile gid %d has no class or \"type\" property", gid)
+	}
+
+	def.Type = tile.props["type"]
+	if def.Type == "" {
+		def.Type = tile.class
+	}
+	if _, ok := ParseTileType(def.Type); !ok {
+		return def, fmt.Errorf("tile gid %d: unknown tile type %q", gid, def.Type)
+	}
+
+	if value, ok := tile.props["solid"]; ok {
+		solid, err := strconv.ParseBool(value)
+		if err != nil {
+			return def, fmt.Errorf("tile gid %d: solid: %v", gid, err)
+		}
+		def.Solid = &solid
+	}
+	if value, ok := tile.props["height"]; ok {
+		height, err := parseFloat32(value)
+		if err != nil {
+			return def, fmt.Errorf("tile gid %d: height: %v", gid, err)
+		}
+		def.Height = &height
+	}
+	return def, nil
+}
+
+// objectCell finds the grid cell under the middle of an object. Tile objects
+// are anchored at their bottom-left corner, everything else at the top-left.
+func (m *tiledMap) objectCell(obj tiledObject) (int, int) {
+	cx := obj.x + obj.w/2
+	cy := obj.y + obj.h/2
+	if obj.gid != 0 {
+		cy = obj.y - obj.h/2
+	}
+	return int(math.Floor(cx / m.tileWidth)), int(math.Floor(cy / m.tileHeight))
+}
+
+func tiledConnection(props map[string]string) (LevelConnection, error) {
+	var conn LevelConnection
+
+	toRoom, err := strconv.Atoi(props["to_room"])
+	if err != nil {
+		return conn, fmt.Errorf("door needs an integer \"to_room\" property")
+	}
+	conn.ToRoom = toRoom
+
+	for _, part := range strings.Split(props["to"], ",") {
+		f, err := parseFloat32(strings.TrimSpace(part))
+		if err != nil {
+			return conn, fmt.Errorf("door needs a \"to\" property like \"1,1,3\"")
+		}
+		conn.To = append(conn.To, f)
+	}
+
+	conn.Direction = props["direction"]
+	if conn.Direction == "" {
+		conn.Direction = directionNames[DirDown]
+	}
+
+	if value, ok := props["requires_key"]; ok {
+		conn.RequiresKey, err = strconv.ParseBool(value)
+		if err != nil {
+			return conn, fmt.Errorf("requires_key: %v", err)
+		}
+	}
+	conn.Key = props["key"]
+	if value, ok := props["consume_key"]; ok {
+		conn.ConsumeKey, err = strconv.ParseBool(value)
+		if err != nil {
+			return conn, fmt.Errorf("consume_key: %v", err)
+		}
+	}
+	return conn, nil
+}
+
+func tiledEntity(class string, obj tiledObject) (LevelEntity, error) {
+	entity := LevelEntity{
+		Type:      class,
+		Sprite:    obj.props["sprite"],
+		Direction: obj.props["direction"],
+		Key:       obj.props["key"],
+	}
+	if entity.Sprite == "" {
+		entity.Sprite = obj.name
+	}
+
+	if _, ok := obj.props["health"]; ok {
+		health, err := propInt(obj.props, "health", 0)
+		if err != nil {
+			return entity, err
+		}
+		entity.Health = &health
+	}
+	for name, field := range map[string]*float32{"move_speed": &entity.MoveSpeed, "move_timer": &entity.MoveTimer} {
+		if value, ok := obj.props[name]; ok {
+			f, err := parseFloat32(value)
+			if err != nil {
+				return entity, fmt.Errorf("%s: %v", name, err)
+			}
+			*field = f
+		}
+	}
+	if value, ok := obj.props["path"]; ok {
+		path, err := parsePath(value)
+		if err != nil {
+			return entity, err
+		}
+		entity.Path = path
+	}
+	if value, ok := obj.props["on"]; ok {
+		on, err := strconv.ParseBool(value)
+		if err != nil {
+			return entity, fmt.Errorf("on: %v", err)
+		}
+		entity.On = on
+	}
+	return entity, nil
+}
+
+func propInt(props map[string]string, name string, fallback int) (int, error) {
+	value, ok := props[name]
+	if !ok {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("property %q: %v", name, err)
+	}
+	return n, nil
+}
+
+func readTiledMap(file string) (*tiledMap, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.ToLower(filepath.Ext(file)) == ".tmx" {
+		return parseTMX(file, data)
+	}
+	return parseTiledJSON(file, data)
+}
+
+func decodeTiledData(text, encoding, compression string) ([]uint32, error) {
+	if encoding == "csv" {
+		var gids []uint32
+		for _, field := range strings.Split(text, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			gid, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			gids = append(gids, uint32(gid))
+		}
+		return gids, nil
+	}
+
+	if encoding != "base64" {
+		return nil, fmt.Errorf("unsupported layer encoding %q (use CSV or Base64)", encoding)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+	if err != nil {
+		return nil, err
+	}
+
+	var r io.Reader = bytes.NewReader(raw)
+	switch compression {
+	case "":
+	case "zlib":
+		r, err = zlib.NewReader(r)
+	case "gzip":
+		r, err = gzip.NewReader(r)
+	default:
+		return nil, fmt.Errorf("unsupported layer compression %q (use none, zlib or gzip)", compression)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err = io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	gids := make([]uint32, len(raw)/4)
+	for i := range gids {
+		gids[i] = binary.LittleEndian.Uint32(raw[i*4:])
+	}
+	return gids, nil
+}
+
+type tmxProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+	Text  string `xml:",chardata"`
+}
+
+type tmxTile struct {
+	ID         int           `xml:"id,attr"`
+	Class      string        `xml:"class,attr"`
+	Type       string        `xml:"type,attr"`
+	Properties []tmxProperty `xml:"properties>property"`
+}
+
+type tmxTileset struct {
+	FirstGID int       `xml:"firstgid,attr"`
+	Source   string    `xml:"source,attr"`
+	Tiles    []tmxTile `xml:"tile"`
+}
+
+type tmxObject struct {
+	ID         int           `xml:"id,attr"`
+	Name       string        `xml:"name,attr"`
+	Class      string        `xml:"class,attr"`
+	Type       string        `xml:"type,attr"`
+	X          float64       `xml:"x,attr"`
+	Y          float64       `xml:"y,attr"`
+	Width      float64       `xml:"width,attr"`
+	Height     float64       `xml:"height,attr"`
+	GID        uint32        `xml:"gid,attr"`
+	Properties []tmxProperty `xml:"properties>property"`
+}
+
+type tmxMap struct {
+	Width      int           `xml:"width,attr"`
+	Height     int           `xml:"height,attr"`
+	TileWidth  float64       `xml:"tilewidth,attr"`
+	TileHeight float64       `xml:"tileheight,attr"`
+	Infinite   int           `xml:"infinite,attr"`
+	Properties []tmxProperty `xml:"properties>property"`
+	Tilesets   []tmxTileset  `xml:"tileset"`
+	Layers     []struct {
+		XMLName    xml.Name
+		Name       string        `xml:"name,attr"`
+		Properties []tmxProperty `xml:"properties>property"`
+		Data       struct {
+			Encoding    string `xml:"encoding,attr"`
+			Compression string `xml:"compression,attr"`
+			Text        string `xml:",chardata"`
+		} `xml:"data"`
+		Objects []tmxObject `xml:"object"`
+	} `xml:",any"`
+}
+
+func tmxProps(props []tmxProperty) map[string]string {
+	m := make(map[string]string)
+	for _, p := range props {
+		if p.Value != "" {
+			m[p.Name] = p.Value
+		} else {
+			m[p.Name] = p.Text
+		}
+	}
+	return m
+}
+
+func tmxTiles(tiles []tmxTile) map[int]tiledTile {
+	m := make(map[int]tiledTile)
+	for _, t := range tiles {
+		class := t.Class
+		if class == "" {
+			class = t.Type
+		}
+		m[t.ID] = tiledTile{class: class, props: tmxProps(t.Properties)}
+	}
+	return m
+}
+
+func parseTMX(file string, data []byte) (*tiledMap, error) {
+	var doc tmxMap
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Infinite != 0 {
+		return nil, fmt.Errorf("infinite maps are not supported")
+	}
+
+	m := &tiledMap{
+		file:       file,
+		width:      doc.Width,
+		height:     doc.Height,
+		tileWidth:  doc.TileWidth,
+		tileHeight: doc.TileHeight,
+		props:      tmxProps(doc.Properties),
+	}
+
+	for _, ts := range doc.Tilesets {
+		tileset := tiledTileset{firstGID: ts.FirstGID, tiles: tmxTiles(ts.Tiles)}
+		if ts.Source != "" {
+			tiles, err := readTiledTileset(filepath.Join(filepath.Dir(file), ts.Source))
+			if err != nil {
+				return nil, err
+			}
+			tileset.tiles = tiles
+		}
+		m.tilesets = append(m.tilesets, tileset)
+	}
+
+	for _, l := range doc.Layers {
+		layer := tiledLayer{name: l.Name, props: tmxProps(l.Properties)}
+		switch l.XMLName.Local {
+		case "layer":
+			gids, err := decodeTiledData(l.Data.Text, l.Data.Encoding, l.Data.Compression)
+			if err != nil {
+				return nil, fmt.Errorf("layer %q: %v", l.Name, err)
+			}
+			if len(gids) != m.width*m.height {
+				return nil, fmt.Errorf("layer %q has %d tiles, expected %d", l.Name, len(gids), m.width*m.height)
+			}
+			layer.data = gids
+		case "objectgroup":
+			layer.objects = true
+			for _, o := range l.Objects {
+				class := o.Class
+				if class == "" {
+					class = o.Type
+				}
+				layer.items = append(layer.items, tiledObject{
+					id: o.ID, name: o.Name, class: class,
+					x: o.X, y: o.Y, w: o.Width, h: o.Height,
+					gid: o.GID, props: tmxProps(o.Properties),
+				})
+			}
+		default:
+			continue
+		}
+		m.layers = append(m.layers, layer)
+	}
+
+	return m, nil
+}
+
+type tiledJSONProperty struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+type tiledJSONTile struct {
+	ID         int                 `json:"id"`
+	Class      string              `json:"class"`
+	Type       string              `json:"type"`
+	Properties []tiledJSONProperty `json:"properties"`
+}
+
+type tiledJSONTileset struct {
+	FirstGID int             `json:"firstgid"`
+	Source   string          `json:"source"`
+	Tiles    []tiledJSONTile `json:"tiles"`
+}
+
+type tiledJSONMap struct {
+	Width      int                 `json:"width"`
+	Height     int                 `json:"height"`
+	TileWidth  float64             `json:"tilewidth"`
+	TileHeight float64             `json:"tileheight"`
+	Infinite   bool                `json:"infinite"`
+	Properties []tiledJSONProperty `json:"properties"`
+	Tilesets   []tiledJSONTileset  `json:"tilesets"`
+	Layers     []struct {
+		Type        string              `json:"type"`
+		Name        string              `json:"name"`
+		Properties  []tiledJSONProperty `json:"properties"`
+		Data        json.RawMessage     `json:"data"`
+		Encoding    string              `json:"encoding"`
+		Compression string              `json:"compression"`
+		Objects     []struct {
+			ID         int                 `json:"id"`
+			Name       string              `json:"name"`
+			Class      string              `json:"class"`
+			Type       string              `json:"type"`
+			X          float64             `json:"x"`
+			Y          float64             `json:"y"`
+			Width      float64             `json:"width"`
+			Height     float64             `json:"height"`
+			GID        uint32              `json:"gid"`
+			Properties []tiledJSONProperty `json:"properties"`
+		} `json:"objects"`
+	} `json:"layers"`
+}
+
+func tiledJSONProps(props []tiledJSONProperty) map[string]string {
+	m := make(map[string]string)
+	for _, p := range props {
+		m[p.Name] = fmt.Sprint(p.Value)
+	}
+	return m
+}
+
+func tiledJSONTiles(tiles []tiledJSONTile) map[int]tiledTile {
+	m := make(map[int]tiledTile)
+	for _, t := range tiles {
+		class := t.Class
+		if class == "" {
+			class = t.Type
+		}
+		m[t.ID] = tiledTile{class: class, props: tiledJSONProps(t.Properties)}
+	}
+	return m
+}
+
+func parseTiledJSON(file string, data []byte) (*tiledMap, error) {
+	var doc tiledJSONMap
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Infinite {
+		return nil, fmt.Errorf("infinite maps are not supported")
+	}
+
+	m := &tiledMap{
+		file:       file,
+		width:      doc.Width,
+		height:     doc.Height,
+		tileWidth:  doc.TileWidth,
+		tileHeight: doc.TileHeight,
+		props:      tiledJSONProps(doc.Properties),
+	}
+
+	for _, ts := range doc.Tilesets {
+		tileset := tiledTileset{firstGID: ts.FirstGID, tiles: tiledJSONTiles(ts.Tiles)}
+		if ts.Source != "" {
+			tiles, err := readTiledTileset(filepath.Join(filepath.Dir(file), ts.Source))
+			if err != nil {
+				return nil, err
+			}
+			tileset.tiles = tiles
+		}
+		m.tilesets = append(m.tilesets, tileset)
+	}
+
+	for _, l := range doc.Layers {
+		layer := tiledLayer{name: l.Name, props: tiledJSONProps(l.Properties)}
+		switch l.Type {
+		case "tilelayer":
+			var gids []uint32
+			var text string
+			if err := json.Unmarshal(l.Data, &gids); err != nil {
+				if err := json.Unmarshal(l.Data, &text); err != nil {
+					return nil, fmt.Errorf("layer %q: data is neither an array nor a string", l.Name)
+				}
+				gids, err = decodeTiledData(text, l.Encoding, l.Compression)
+				if err != nil {
+					return nil, fmt.Errorf("layer %q: %v", l.Name, err)
+				}
+			}
+			if len(gids) != m.width*m.height {
+				return nil, fmt.Errorf("layer %q has %d tiles, expected %d", l.Name, len(gids), m.width*m.height)
+			}
+			layer.data = gids
+		case "objectgroup":
+			layer.objects = true
+			for _, o := range l.Objects {
+				class := o.Class
+				if class == "" {
+					class = o.Type
+				}
+				layer.items = append(layer.items, tiledObject{
+					id: o.ID, name: o.Name, class: class,
+					x: o.X, y: o.Y, w: o.Width, h: o.Height,
+					gid: o.GID, props: tiledJSONProps(o.Properties),
+				})
+			}
+		default:
+			continue
+		}
+		m.layers = append(m.layers, layer)
+	}
+
+	return m, nil
+}
+
+// readTiledTileset reads an external tileset, either .tsx or JSON.
+func readTiledTileset(file string) (map[int]tiledTile, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.ToLower(filepath.Ext(file)) == ".tsx" {
+		var ts tmxTileset
+		if err := xml.Unmarshal(data, &ts); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		return tmxTiles(ts.Tiles), nil
+	}
+
+	var ts tiledJSONTileset
+	if err := json.Unmarshal(data, &ts); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return tiledJSONTiles(ts.Tiles), nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const tiledTestMap = `{"type": "map", "width": 3, "height": 3, "tilewidth": 16, "tileheight": 16,
+ "properties": [{"name": "room_id", "type": "int", "value": 1}, {"name": "height", "type": "int", "value": 3}],
+ "tilesets": [{"firstgid": 1, "tiles": [{"id": 0, "class": "floor_stone"}]}],
+ "layers": [{"type": "tilelayer", "width": 3, "height": 3, "data": [1, 1, 1, 1, 1, 1, 1, 1, 1]}]}`
+
+// TestLoadLevelTiled checks that LoadLevel imports a directory of maps and a
+// map saved as .json, rather than reading them as level files.
+func TestLoadLevelTiled(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "hall.tmj"), []byte(tiledTestMap), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "hall.json"), []byte(tiledTestMap), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{dir, filepath.Join(dir, "hall.json")} {
+		fg := &FilmationGame{}
+		if err := fg.LoadLevel(path); err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		if room := fg.Rooms.Rooms[1]; room == nil || room.World.Width != 3 || room.World.Depth != 3 {
+			t.Errorf("%s: room 1 not imported", path)
+		}
+	}
+
+	if isTiledPath("game_assets/levels/mansion.json") {
+		t.Error("a level file is taken for a Tiled map")
+	}
+}
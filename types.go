@@ -56,6 +56,9 @@ const (
 	EntityEnemy
 	EntityNPC
 	EntityEffect
+	EntityBlock
+	EntityPlatform
+	EntitySwitch
 )
 
 type GameEntity struct {
@@ -76,6 +79,30 @@ type GameEntity struct {
 	IsMoving       bool
 	MoveSpeed      float32
 	MoveTimer      float32
+
+	// VelocityY is how fast the entity is rising, or falling if negative.
+	// See gravity.go.
+	VelocityY float32
+
+	// Path is the waypoints a platform travels between. It is heading from
+	// Path[PathIndex] to the next one, PathProgress of the way there. See
+	// platforms.go.
+	Path         []Point3D
+	PathIndex    int
+	PathProgress float32
+
+	// Key names the lock a key item opens. See keys.go.
+	Key string
+
+	// On is whether a switch is on. See switches.go.
+	On bool
+
+	// Script is the path of the entity's script, if it has one. See
+	// scripts.go.
+	Script string
+
+	// Dialogue is the path of an NPC's dialogue. See dialogue.go.
+	Dialogue string
 }
 
 type SpriteCache struct {
@@ -101,7 +128,6 @@ type World3D struct {
 type FilmationGame struct {
 	Sprites SpriteCache
 	World   World3D
-	Player  *GameEntity
 	Camera  Point3D
 	Scale   float32
 	ScreenW int32
@@ -109,7 +135,32 @@ type FilmationGame struct {
 
 	Rooms RoomManager
 
+	// The player and anyone travelling with them belong to the game rather
+	// than to a room, and go wherever the player goes.
+	Player     *GameEntity
+	Companions []*GameEntity
+
 	AssetPath string
+	LevelPath string
+	SaveDir   string
+
+	// With Generate set, a new game generates a mansion from Seed in place
+	// of loading LevelPath.
+	Generate bool
+	Seed     int64
+
+	// States is the stack of screens, the top one taking input, and Quit
+	// ends the game. See states.go.
+	States       []GameState
+	Quit         bool
+	menuSelected int
+	checkpoint   []byte
+
+	// Config is the player's settings, kept at ConfigPath, and rebinding
+	// the action the options menu is waiting for a key for. See config.go.
+	Config     Config
+	ConfigPath string
+	rebinding  string
 
 	// Music support - this is the key addition
 	BackgroundMusic rl.Music
@@ -122,14 +173,46 @@ type FilmationGame struct {
 
 	ItemsCollected int
 	EnemiesKilled  int
+
+	// Keys counts the keys the player carries by name.
+	Keys      map[string]int
+	Inventory Inventory
+
+	damageCarry float32
+
+	// doorSwing is how far open each door in the room that is opening or
+	// closing is drawn, from 0 to 1. See doors.go.
+	doorSwing map[Point3D]float32
+
+	Message     string
+	MessageTime float32
+
+	Picker   SlotPicker
+	Dialogue DialogueBox
+
+	// Objectives are what the level asks of the player, and Won is set
+	// once every one that is not optional is done. See objectives.go.
+	Objectives []Objective
+	Won        bool
+
+	// Scripts holds every script the level uses, by path, and LevelScript
+	// names the one for the whole level. ScriptVars are the variables they
+	// share. See scripts.go.
+	Scripts      map[string]*Script
+	LevelScript  string
+	ScriptVars   map[string]int
+	WatchScripts bool
+	scriptWatch  float32
+	scriptGoto   func()
 }
 
 type RenderItem struct {
-	Position Point3D
-	Depth    float32
-	Type     string
-	TileData *Tile3D
-	EntityID int
+	Position   Point3D
+	Depth      float32
+	Type       string
+	TileData   *Tile3D
+	EntityData *GameEntity
+	EntityID   int
 }
 
 func BoundingBoxesIntersect(a, b BoundingBox3D) bool {
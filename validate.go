@@ -0,0 +1,369 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// RoomProblem is something wrong with how the rooms of a mansion fit
+// together, such as a door that leads into a wall.
+type RoomProblem struct {
+	Room int
+	At   *Point3D
+	Msg  string
+}
+
+func (p RoomProblem) Error() string {
+	if p.At == nil {
+		return fmt.Sprintf("room %d: %s", p.Room, p.Msg)
+	}
+	return fmt.Sprintf("room %d %s: %s", p.Room, formatPoint(*p.At), p.Msg)
+}
+
+type RoomProblems []RoomProblem
+
+func (problems RoomProblems) Error() string {
+	lines := make([]string, len(problems))
+	for i, p := range problems {
+		lines[i] = p.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func formatPoint(p Point3D) string {
+	return fmt.Sprintf("(%s,%s,%s)", formatFloat(p.X), formatFloat(p.Y), formatFloat(p.Z))
+}
+
+// RoomReachable flood-fills the walkable cells of a room from one cell,
+// across its Y level and up and down its stairs. A cell is walkable if its
+// tile is not solid, following the same rule as IsPositionSolid, or is a
+// door, since closed doors can be opened. Stepping onto a cell with nothing
+// below to stand on drops the player to where gravity would land them, and
+// there is no climbing back. Jumps are not followed, so a ledge that can
+// only be jumped onto counts as out of reach. Entities are ignored, since
+// they move, except that a platform takes the player between the cells
+// above its waypoints, and holds them up there. The result is indexed
+// [x][y][z].
+func RoomReachable(world *World3D, from Point3D) [][][]bool {
+	seen := make([][][]bool, world.Width)
+	for x := range seen {
+		seen[x] = make([][]bool, world.Height)
+		for y := range seen[x] {
+			seen[x][y] = make([]bool, world.Depth)
+		}
+	}
+
+	walkable := func(x, y, z int) bool {
+		return !world.IsTileSolid(x, y, z) || world.isDoor(x, y, z)
+	}
+
+	fx, fy, fz := int(from.X), int(from.Y), int(from.Z)
+	if !walkable(fx, fy, fz) {
+		return seen
+	}
+
+	var rides [][][3]int
+	for _, entity := range world.Entities {
+		if entity.Active && entity.Type == EntityPlatform {
+			var stops [][3]int
+			for _, p := range entity.Path {
+				stops = append(stops, [3]int{int(p.X), int(p.Y) + 1, int(p.Z)})
+			}
+			rides = append(rides, stops)
+		}
+	}
+
+	queue := [][3]int{{fx, fy, fz}}
+	seen[fx][fy][fz] = true
+	visit := func(x, y, z int) {
+		if !walkable(x, y, z) {
+			return
+		}
+		held := world.supports(x, y-1, z)
+		for _, stops := range rides {
+			held = held || slices.Contains(stops, [3]int{x, y, z})
+		}
+		if !held {
+			y = world.restLevel(x, z, float32(y))
+		}
+		if !seen[x][y][z] {
+			seen[x][y][z] = true
+			queue = append(queue, [3]int{x, y, z})
+		}
+	}
+	for len(queue) > 0 {
+		cell := queue[0]
+		queue = queue[1:]
+		x, y, z := cell[0], cell[1], cell[2]
+		for _, step := range [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+			visit(x+step[0], y, z+step[1])
+		}
+		if to, ok := world.StairsDestination(x, y, z); ok {
+			visit(int(to.X), int(to.Y), int(to.Z))
+		}
+		for _, stops := range rides {
+			if slices.Contains(stops, cell) {
+				for _, stop := range stops {
+					visit(stop[0], stop[1], stop[2])
+				}
+			}
+		}
+	}
+	return seen
+}
+
+// pathBlocked finds the first cell along a platform's path that the platform,
+// or something standing on it, would have to move through but cannot.
+func pathBlocked(world *World3D, path []Point3D) ([3]int, bool) {
+	for i, from := range path {
+		to := path[(i+1)%len(path)]
+		steps := int(abs(to.X-from.X) + abs(to.Y-from.Y) + abs(to.Z-from.Z))
+		for s := 0; s <= steps; s++ {
+			p := LerpPoint3D(from, to, float32(s)/float32(max(steps, 1)))
+			x, y, z := int(p.X+0.5), int(p.Y+0.5), int(p.Z+0.5)
+			for _, level := range []int{y, y + 1} {
+				if world.blocksAt(x, level, z) {
+					return [3]int{x, level, z}, true
+				}
+			}
+		}
+	}
+	return [3]int{}, false
+}
+
+func reachedCell(seen [][][]bool, p Point3D) bool {
+	x, y, z := int(p.X), int(p.Y), int(p.Z)
+	if x < 0 || x >= len(seen) || y < 0 || y >= len(seen[x]) || z < 0 || z >= len(seen[x][y]) {
+		return false
+	}
+	return seen[x][y][z]
+}
+
+// CheckRooms walks the mansion from the player's position and reports every
+// door that leads nowhere, into a wall, to the wrong floor or has no way
+// back, every flight of stairs that leads nowhere, every platform whose path
+// is blocked, every room and door the player cannot get to, and every locked
+// door whose key cannot be picked up before reaching it. It changes
+// nothing, so it can be run on a game being played.
+func (fg *FilmationGame) CheckRooms() RoomProblems {
+	// The room being played is newer than its stored copy.
+	rooms := maps.Clone(fg.Rooms.Rooms)
+	if current := rooms[fg.Rooms.CurrentRoom]; current != nil && fg.World.Tiles != nil {
+		playing := *current
+		playing.World = fg.World
+		rooms[playing.ID] = &playing
+	}
+
+	var problems RoomProblems
+	report := func(room int, at *Point3D, format string, args ...interface{}) {
+		problems = append(problems, RoomProblem{Room: room, At: at, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	ids := make([]int, 0, len(rooms))
+	for id := range rooms {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		room := rooms[id]
+		for _, conn := range room.Connections {
+			at := conn.Position
+			if room.World.IsTileSolid(int(at.X), int(at.Y), int(at.Z)) && !room.World.isDoor(int(at.X), int(at.Y), int(at.Z)) {
+				report(id, &at, "door is inside a wall or outside the room")
+			}
+
+			to := rooms[conn.ToRoomID]
+			if to == nil {
+				report(id, &at, "door leads to room %d, which does not exist", conn.ToRoomID)
+				continue
+			}
+
+			dest := conn.ToPosition
+			x, y, z := int(dest.X), int(dest.Y), int(dest.Z)
+			switch {
+			case x < 0 || x >= to.World.Width || y < 0 || y >= to.World.Height || z < 0 || z >= to.World.Depth:
+				report(id, &at, "door leads to %s, outside room %d", formatPoint(dest), conn.ToRoomID)
+			case to.World.blocksAt(x, y, z):
+				report(id, &at, "door leads into %s at %s in room %d", to.World.Tiles[x][y][z].Type, formatPoint(dest), conn.ToRoomID)
+			case to.World.solidEntityAt(dest, nil) != nil:
+				entity := to.World.solidEntityAt(dest, nil)
+				report(id, &at, "door leads onto %s %d at %s in room %d", entityTypeNames[entity.Type], entity.ID, formatPoint(dest), conn.ToRoomID)
+			}
+
+			fromStorey := room.Storey + storeyOf(at.Y)
+			toStorey := to.Storey + storeyOf(dest.Y)
+			onStairs := room.World.isStairs(int(at.X), int(at.Y), int(at.Z))
+			switch {
+			case onStairs && (toStorey-fromStorey)*(toStorey-fromStorey) != 1:
+				report(id, &at, "stairs to room %d go from floor %d to floor %d", conn.ToRoomID, fromStorey, toStorey)
+			case !onStairs && toStorey != fromStorey:
+				report(id, &at, "door to room %d leads from floor %d to floor %d", conn.ToRoomID, fromStorey, toStorey)
+			}
+
+			back := false
+			for _, c := range to.Connections {
+				if c.ToRoomID == id && c.Active {
+					back = true
+				}
+			}
+			if conn.Active && !back {
+				report(id, &at, "door to room %d has no door back", conn.ToRoomID)
+			}
+		}
+	}
+
+	for _, id := range ids {
+		room := rooms[id]
+		world := &room.World
+		for x := 0; x < world.Width; x++ {
+			for y := 0; y < world.Height; y++ {
+				for z := 0; z < world.Depth; z++ {
+					if world.Tiles[x][y][z].Type != TileStairs {
+						continue
+					}
+					at := Point3D{X: float32(x), Y: float32(y), Z: float32(z)}
+					linked := false
+					for _, conn := range room.Connections {
+						linked = linked || conn.Position == at
+					}
+					if _, ok := world.StairsDestination(x, y, z); !ok && !linked {
+						report(id, &at, "stairs lead nowhere: there are no stairs two levels above or below, and no door here")
+					}
+				}
+			}
+		}
+
+		for _, entity := range world.Entities {
+			if entity.Active && entity.Type == EntityPlatform {
+				if cell, ok := pathBlocked(world, entity.Path); ok {
+					at := entity.Position
+					report(id, &at, "platform path is blocked at %s, by a tile in its way or in the way of what it carries", formatPoint(Point3D{X: float32(cell[0]), Y: float32(cell[1]), Z: float32(cell[2])}))
+				}
+			}
+		}
+	}
+
+	start := rooms[fg.Rooms.CurrentRoom]
+	if start == nil || fg.Player == nil {
+		report(fg.Rooms.CurrentRoom, nil, "the player does not start in a room")
+		return problems
+	}
+	startPos := fg.Player.Position
+	if start.World.IsTileSolid(int(startPos.X), int(startPos.Y), int(startPos.Z)) {
+		report(start.ID, &startPos, "the player starts inside a wall or outside the room")
+		return problems
+	}
+
+	// Walk the mansion one arrival at a time. Locked doors wait until their
+	// key has been found somewhere. Keys that doors use up are not counted,
+	// so a key is only checked to exist, not to be left over.
+	type arrival struct {
+		room int
+		pos  Point3D
+	}
+	type doorRef struct {
+		room, index int
+	}
+
+	visited := map[arrival]bool{}
+	reachedRooms := map[int]bool{}
+	reachedDoors := map[doorRef]bool{}
+	var waiting []doorRef
+	haveKeys := map[string]bool{}
+	for key := range fg.Keys {
+		haveKeys[key] = true
+	}
+
+	queue := []arrival{{start.ID, startPos}}
+	visited[queue[0]] = true
+	enter := func(d doorRef) {
+		conn := rooms[d.room].Connections[d.index]
+		next := arrival{conn.ToRoomID, conn.ToPosition}
+		if rooms[next.room] != nil && !visited[next] {
+			visited[next] = true
+			queue = append(queue, next)
+		}
+	}
+
+	for len(queue) > 0 {
+		for len(queue) > 0 {
+			a := queue[0]
+			queue = queue[1:]
+			room := rooms[a.room]
+			reachedRooms[a.room] = true
+			if room.World.IsTileSolid(int(a.pos.X), int(a.pos.Y), int(a.pos.Z)) {
+				continue
+			}
+			seen := RoomReachable(&room.World, a.pos)
+
+			for _, e := range room.World.Entities {
+				if e.Active && isKey(&e) && reachedCell(seen, e.Position) {
+					haveKeys[e.Key] = true
+				}
+			}
+
+			for i, conn := range room.Connections {
+				d := doorRef{a.room, i}
+				if !conn.Active || reachedDoors[d] || !reachedCell(seen, conn.Position) {
+					continue
+				}
+				reachedDoors[d] = true
+				if conn.RequiresKey && !haveKeys[conn.Key] {
+					waiting = append(waiting, d)
+					continue
+				}
+				enter(d)
+			}
+		}
+
+		var stillWaiting []doorRef
+		for _, d := range waiting {
+			if haveKeys[rooms[d.room].Connections[d.index].Key] {
+				enter(d)
+			} else {
+				stillWaiting = append(stillWaiting, d)
+			}
+		}
+		waiting = stillWaiting
+	}
+
+	for _, d := range waiting {
+		conn := rooms[d.room].Connections[d.index]
+		report(d.room, &conn.Position, "door to room %d needs %s, but it cannot be picked up before the door", conn.ToRoomID, keyName(conn.Key))
+	}
+
+	for _, id := range ids {
+		room := rooms[id]
+		if !reachedRooms[id] {
+			ways := 0
+			for _, other := range rooms {
+				for _, c := range other.Connections {
+					if c.ToRoomID == id && c.Active && other.ID != id {
+						ways++
+					}
+				}
+			}
+			if ways == 0 {
+				report(id, nil, "no door leads into this room")
+			} else {
+				report(id, nil, "cannot be reached from the start")
+			}
+			continue
+		}
+
+		for i, conn := range room.Connections {
+			if conn.Active && !reachedDoors[doorRef{id, i}] {
+				report(id, &conn.Position, "door to room %d cannot be reached from where the player enters", conn.ToRoomID)
+			}
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Room < problems[j].Room
+	})
+	return problems
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// twoRooms builds a hall and a vault joined by a door each way, with the
+// player in the hall.
+func twoRooms() *FilmationGame {
+	fg := &FilmationGame{}
+	fg.InitRoomSystem()
+	fg.BuildBasicRoom(fg.CreateRoom(1, "Hall", 6, 3, 6), TileStoneFloor)
+	fg.BuildBasicRoom(fg.CreateRoom(2, "Vault", 6, 3, 6), TileStoneFloor)
+	fg.AddRoomConnection(1, 2, Point3D{X: 5, Y: 1, Z: 2}, Point3D{X: 1, Y: 1, Z: 2}, DirRight, false)
+	fg.AddRoomConnection(2, 1, Point3D{X: 0, Y: 1, Z: 2}, Point3D{X: 4, Y: 1, Z: 2}, DirLeft, false)
+	return fg
+}
+
+func TestCheckRooms(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(fg *FilmationGame)
+		want  []string
+	}{
+		{
+			name:  "rooms that fit together",
+			setup: func(fg *FilmationGame) {},
+		},
+		{
+			name: "door landing in a wall",
+			setup: func(fg *FilmationGame) {
+				fg.Rooms.Rooms[1].Connections[0].ToPosition = Point3D{X: 0, Y: 1, Z: 0}
+			},
+			want: []string{"room 1 (5,1,2): door leads into wall_stone at (0,1,0) in room 2"},
+		},
+		{
+			name: "door landing outside the room",
+			setup: func(fg *FilmationGame) {
+				fg.Rooms.Rooms[1].Connections[0].ToPosition = Point3D{X: 9, Y: 1, Z: 2}
+			},
+			want: []string{"room 1 (5,1,2): door leads to (9,1,2), outside room 2"},
+		},
+		{
+			name: "door landing in the floor",
+			setup: func(fg *FilmationGame) {
+				fg.Rooms.Rooms[1].Connections[0].ToPosition = Point3D{X: 1, Y: 0, Z: 2}
+			},
+			want: []string{"room 1 (5,1,2): door leads into floor_stone at (1,0,2) in room 2"},
+		},
+		{
+			name: "door landing on a block",
+			setup: func(fg *FilmationGame) {
+				vault := fg.Rooms.Rooms[2]
+				vault.World.Entities = append(vault.World.Entities, NewEntity(10, EntityBlock, Point3D{X: 1, Y: 1, Z: 2}, 0))
+			},
+			want: []string{"room 1 (5,1,2): door leads onto block 10 at (1,1,2) in room 2"},
+		},
+		{
+			name: "no return connection",
+			setup: func(fg *FilmationGame) {
+				fg.Rooms.Rooms[2].Connections = nil
+			},
+			want: []string{"room 1 (5,1,2): door to room 2 has no door back"},
+		},
+		{
+			name: "room with no door in",
+			setup: func(fg *FilmationGame) {
+				fg.BuildBasicRoom(fg.CreateRoom(3, "Attic", 5, 3, 5), TileWoodFloor)
+			},
+			want: []string{"room 3: no door leads into this room"},
+		},
+		{
+			name: "room behind a wall",
+			setup: func(fg *FilmationGame) {
+				hall := fg.Rooms.Rooms[1]
+				for z := 1; z < 5; z++ {
+					hall.World.Tiles[3][1][z] = NewTile(TileBrickWall, 3, 1, z)
+				}
+			},
+			want: []string{
+				"room 1 (5,1,2): door to room 2 cannot be reached from where the player enters",
+				"room 2: cannot be reached from the start",
+			},
+		},
+		{
+			name: "room across a hole in the floor",
+			setup: func(fg *FilmationGame) {
+				hall := fg.Rooms.Rooms[1]
+				for z := 1; z < 5; z++ {
+					hall.World.Tiles[3][0][z] = Tile3D{}
+				}
+			},
+			want: []string{
+				"room 1 (5,1,2): door to room 2 cannot be reached from where the player enters",
+				"room 2: cannot be reached from the start",
+			},
+		},
+		{
+			name: "key placed after its lock",
+			setup: func(fg *FilmationGame) {
+				door := &fg.Rooms.Rooms[1].Connections[0]
+				door.RequiresKey, door.Key = true, "red"
+				vault := fg.Rooms.Rooms[2]
+				key := NewEntity(10, EntityItem, Point3D{X: 3, Y: 1, Z: 3}, keySpriteID)
+				key.Key = "red"
+				vault.World.Entities = append(vault.World.Entities, key)
+			},
+			want: []string{"room 1 (5,1,2): door to room 2 needs the red key, but it cannot be picked up before the door"},
+		},
+		{
+			name: "key placed before its lock",
+			setup: func(fg *FilmationGame) {
+				door := &fg.Rooms.Rooms[1].Connections[0]
+				door.RequiresKey, door.Key = true, "red"
+				hall := fg.Rooms.Rooms[1]
+				key := NewEntity(10, EntityItem, Point3D{X: 1, Y: 1, Z: 4}, keySpriteID)
+				key.Key = "red"
+				hall.World.Entities = append(hall.World.Entities, key)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		fg := twoRooms()
+		test.setup(fg)
+		fg.SetupPlayerInRoom(1, Point3D{X: 1, Y: 1, Z: 1})
+
+		problems := fg.CheckRooms()
+		got := make([]string, len(problems))
+		for i, p := range problems {
+			got[i] = p.Error()
+		}
+		for _, want := range test.want {
+			found := false
+			for _, g := range got {
+				found = found || strings.Contains(g, want)
+			}
+			if !found {
+				t.Errorf("%s: no problem %q in\n%s", test.name, want, strings.Join(got, "\n"))
+			}
+		}
+		if len(test.want) == 0 && len(got) > 0 {
+			t.Errorf("%s: want no problems, got\n%s", test.name, strings.Join(got, "\n"))
+		}
+	}
+}
+
+// TestCheckRoomsChangesNothing checks that validating a game being played
+// leaves it as it was.
+func TestCheckRoomsChangesNothing(t *testing.T) {
+	fg := twoRooms()
+	fg.SetupPlayerInRoom(1, Point3D{X: 1, Y: 1, Z: 1})
+	fg.World.Entities = append(fg.World.Entities, NewEntity(10, EntityItem, Point3D{X: 2, Y: 1, Z: 2}, 1))
+	stored := len(fg.Rooms.Rooms[1].World.Entities)
+
+	if problems := fg.CheckRooms(); len(problems) > 0 {
+		t.Fatal(problems)
+	}
+	if len(fg.Rooms.Rooms[1].World.Entities) != stored {
+		t.Error("CheckRooms stored the room being played")
+	}
+}
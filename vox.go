@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MagicaVoxel (.vox) models can be used as room geometry. The conventions
+// are documented in docs/voxels.md.
+
+type VoxModel struct {
+	SizeX, SizeY, SizeZ int
+	Voxels              []Voxel
+}
+
+type Voxel struct {
+	X, Y, Z uint8
+	Index   uint8
+}
+
+// VoxPalette maps MagicaVoxel palette indices to what they stand for in a
+// room, using the same symbols as a layout legend.
+type VoxPalette map[int]LayoutSymbol
+
+// DefaultVoxPalette maps palette index N to TileType N, so index 1 is a stone
+// floor, index 5 a stone wall and index 12 a ceiling.
+func DefaultVoxPalette() VoxPalette {
+	palette := make(VoxPalette)
+	for t, name := range tileTypeNames {
+		if t != TileEmpty {
+			palette[int(t)] = LayoutSymbol{Tile: LevelTile{Type: name}}
+		}
+	}
+	return palette
+}
+
+// ParseVoxPalette reads palette entries such as {"1": "floor_stone",
+// "40": "item key"} on top of the default palette.
+func ParseVoxPalette(entries map[string]string) (VoxPalette, error) {
+	palette := DefaultVoxPalette()
+
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		index, err := strconv.Atoi(key)
+		if err != nil || index < 1 || index > 255 {
+			return nil, fmt.Errorf("palette index %q must be a number from 1 to 255", key)
+		}
+		fields := strings.Fields(entries[key])
+		if len(fields) == 0 {
+			delete(palette, index)
+			continue
+		}
+		symbol, err := parseLayoutSymbol(fields)
+		if err != nil {
+			return nil, fmt.Errorf("palette index %d: %v", index, err)
+		}
+		palette[index] = symbol
+	}
+
+	return palette, nil
+}
+
+// maxVoxSize is the largest model MagicaVoxel makes along each axis. Voxel
+// coordinates are a byte each, so a bigger model could not be filled.
+const maxVoxSize = 256
+
+func ParseVox(r io.Reader) ([]VoxModel, error) {
+	var header struct {
+		Magic   [4]byte
+		Version int32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	if string(header.Magic[:]) != "VOX " {
+		return nil, fmt.Errorf("not a MagicaVoxel file")
+	}
+
+	main, err := readVoxChunkHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if main.id != "MAIN" {
+		return nil, fmt.Errorf("expected MAIN chunk, got %q", main.id)
+	}
+	if _, err := io.CopyN(io.Discard, r, int64(main.contentSize)); err != nil {
+		return nil, err
+	}
+
+	var models []VoxModel
+	var size *VoxModel
+	children := io.LimitReader(r, int64(main.childrenSize))
+	for {
+		chunk, err := readVoxChunkHeader(children)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		content := io.LimitReader(children, int64(chunk.contentSize))
+
+		switch chunk.id {
+		case "SIZE":
+			var dims [3]int32
+			if err := binary.Read(content, binary.LittleEndian, &dims); err != nil {
+				return nil, fmt.Errorf("SIZE chunk: %v", err)
+			}
+			for _, d := range dims {
+				if d <= 0 || d > maxVoxSize {
+					return nil, fmt.Errorf("SIZE chunk: model size %dx%dx%d is not between 1 and %d on each axis", dims[0], dims[1], dims[2], maxVoxSize)
+				}
+			}
+			size = &VoxModel{SizeX: int(dims[0]), SizeY: int(dims[1]), SizeZ: int(dims[2])}
+		case "XYZI":
+			if size == nil {
+				return nil, fmt.Errorf("XYZI chunk without a SIZE chunk before it")
+			}
+			var count int32
+			if err := binary.Read(content, binary.LittleEndian, &count); err != nil {
+				return nil, fmt.Errorf("XYZI chunk: %v", err)
+			}
+			// Each voxel is four bytes, after the four of the count.
+			if count < 0 || int64(count)*4 > int64(chunk.contentSize)-4 {
+				return nil, fmt.Errorf("XYZI chunk: %d voxels do not fit in %d bytes", count, chunk.contentSize)
+			}
+			model := *size
+			model.Voxels = make([]Voxel, count)
+			if err := binary.Read(content, binary.LittleEndian, model.Voxels); err != nil {
+				return nil, fmt.Errorf("XYZI chunk: %v", err)
+			}
+			models = append(models, model)
+			size = nil
+		}
+
+		// Everything else (palette, materials, scene graph) says nothing
+		// about which tile goes where, so it is skipped.
+		if _, err := io.Copy(io.Discard, content); err != nil {
+			return nil, err
+		}
+		if _, err := io.CopyN(io.Discard, children, int64(chunk.childrenSize)); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(models) == 0 {
+		return nil, fmt.Errorf("file has no models")
+	}
+	return models, nil
+}
+
+type voxChunkHeader struct {
+	id           string
+	contentSize  int32
+	childrenSize int32
+}
+
+func readVoxChunkHeader(r io.Reader) (voxChunkHeader, error) {
+	var raw struct {
+		ID           [4]byte
+		ContentSize  int32
+		ChildrenSize int32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &raw); err != nil {
+		return voxChunkHeader{}, err
+	}
+	if raw.ContentSize < 0 || raw.ChildrenSize < 0 {
+		return voxChunkHeader{}, fmt.Errorf("chunk %q has a negative size", raw.ID[:])
+	}
+	return voxChunkHeader{id: string(raw.ID[:]), contentSize: raw.ContentSize, childrenSize: raw.ChildrenSize}, nil
+}
+
+// World builds a room's tiles and entities from the model. MagicaVoxel's Z
+// axis points up, so it becomes the room's Y axis and the model's Y axis
+// becomes the room's depth.
+func (m VoxModel) World(palette VoxPalette) (*World3D, error) {
+	world := &World3D{Width: m.SizeX, Height: m.SizeZ, Depth: m.SizeY}
+	world.Tiles = makeTiles(world.Width, world.Height, world.Depth)
+
+	unmapped := make(map[int]int)
+	for _, v := range m.Voxels {
+		x, y, z := int(v.X), int(v.Z), int(v.Y)
+		if x >= world.Width || y >= world.Height || z >= world.Depth {
+			return nil, fmt.Errorf("voxel (%d,%d,%d) is outside the model (%dx%dx%d)", v.X, v.Y, v.Z, m.SizeX, m.SizeY, m.SizeZ)
+		}
+		symbol, ok := palette[int(v.Index)]
+		if !ok {
+			unmapped[int(v.Index)]++
+			continue
+		}
+		symbol.place(world, x, y, z)
+	}
+
+	if len(unmapped) > 0 {
+		var parts []string
+		for index, count := range unmapped {
+			parts = append(parts, fmt.Sprintf("%d (%d voxels)", index, count))
+		}
+		sort.Strings(parts)
+		return nil, fmt.Errorf("palette indices with no tile type: %s", strings.Join(parts, ", "))
+	}
+	return world, nil
+}
+
+func readVoxModels(path string) ([]VoxModel, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	models, err := ParseVox(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return models, nil
+}
+
+// ImportVox turns every model in a .vox file into a room, numbered from 1
+// in file order. Without a start object the player starts in the middle of
+// room 1, one level above the floor.
+func ImportVox(path string, palette VoxPalette) (*Level, error) {
+	models, err := readVoxModels(path)
+	if err != nil {
+		return nil, err
+	}
+
+	level := &Level{
+		File:    path,
+		Data:    LevelFile{Version: LevelFormatVersion},
+		Layouts: make(map[int]*World3D),
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	for i, model := range models {
+		world, err := model.World(palette)
+		if err != nil {
+			return nil, LevelErrors{{File: path, Msg: fmt.Sprintf("model %d: %v", i, err)}}
+		}
+		level.Data.Rooms = append(level.Data.Rooms, LevelRoom{
+			ID:   i + 1,
+			Name: fmt.Sprintf("%s %d", name, i+1),
+			Size: []int{world.Width, world.Height, world.Depth},
+		})
+		level.Layouts[i] = world
+	}
+
+	first := level.Data.Rooms[0]
+	level.Data.Start = LevelStart{
+		Room:     first.ID,
+		Position: []float32{float32(first.Size[0] / 2), min(1, float32(first.Size[1]-1)), float32(first.Size[2] / 2)},
+	}
+
+	if errs := level.Validate(); len(errs) > 0 {
+		return nil, errs
+	}
+	return level, nil
+}
+
+func (fg *FilmationGame) LoadVox(path string, palette VoxPalette) error {
+	fmt.Printf("Importing MagicaVoxel models: %s\n", path)
+
+	level, err := ImportVox(path, palette)
+	if err != nil {
+		return err
+	}
+	return fg.BuildLevel(level)
+}
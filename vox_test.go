@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func voxTestChunk(id string, content []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString(id)
+	binary.Write(&b, binary.LittleEndian, int32(len(content)))
+	binary.Write(&b, binary.LittleEndian, int32(0))
+	b.Write(content)
+	return b.Bytes()
+}
+
+// voxTestFile makes a .vox file with one model of the given size, whose
+// XYZI chunk says it holds count voxels and holds voxels.
+func voxTestFile(dims [3]int32, count int32, voxels []Voxel) []byte {
+	var size, xyzi bytes.Buffer
+	binary.Write(&size, binary.LittleEndian, dims)
+	binary.Write(&xyzi, binary.LittleEndian, count)
+	binary.Write(&xyzi, binary.LittleEndian, voxels)
+	children := append(voxTestChunk("SIZE", size.Bytes()), voxTestChunk("XYZI", xyzi.Bytes())...)
+
+	var b bytes.Buffer
+	b.WriteString("VOX ")
+	binary.Write(&b, binary.LittleEndian, int32(150))
+	b.WriteString("MAIN")
+	binary.Write(&b, binary.LittleEndian, int32(0))
+	binary.Write(&b, binary.LittleEndian, int32(len(children)))
+	b.Write(children)
+	return b.Bytes()
+}
+
+func TestParseVox(t *testing.T) {
+	voxels := []Voxel{{X: 0, Y: 0, Z: 0, Index: 1}, {X: 1, Y: 2, Z: 0, Index: 1}}
+	models, err := ParseVox(bytes.NewReader(voxTestFile([3]int32{3, 4, 2}, 2, voxels)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(models) != 1 || models[0].SizeX != 3 || models[0].SizeY != 4 || models[0].SizeZ != 2 || len(models[0].Voxels) != 2 {
+		t.Fatalf("got %+v", models)
+	}
+}
+
+func TestParseVoxErrors(t *testing.T) {
+	voxels := []Voxel{{X: 0, Y: 0, Z: 0, Index: 1}}
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"negative count", voxTestFile([3]int32{2, 2, 2}, -1, voxels), "do not fit"},
+		{"huge count", voxTestFile([3]int32{2, 2, 2}, 1<<30, voxels), "do not fit"},
+		{"count past the chunk", voxTestFile([3]int32{2, 2, 2}, 2, voxels), "do not fit"},
+		{"zero size", voxTestFile([3]int32{2, 0, 2}, 1, voxels), "model size"},
+		{"negative size", voxTestFile([3]int32{-4, 2, 2}, 1, voxels), "model size"},
+		{"too big", voxTestFile([3]int32{2, 2, maxVoxSize + 1}, 1, voxels), "model size"},
+		{"not a vox file", []byte("PNG 1234"), "not a MagicaVoxel file"},
+	}
+	for _, test := range tests {
+		_, err := ParseVox(bytes.NewReader(test.data))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got error %v, want one saying %q", test.name, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+// Wires connect a room's switches to the things they work. Each wire reads
+// one or more switches, combines them with its logic, and acts on a target
+// whenever the result changes: a door to open or close, a connection to
+// turn on or off, tiles to change, or an entity to bring into the room.
+//
+// Targets and wires belong to a room, and are only worked while the player
+// is in it; a timed wire in a room the player has left waits for them to
+// come back.
+
+type WireLogic int
+
+const (
+	// LogicOr is on while any of the wire's switches is on.
+	LogicOr WireLogic = iota
+	// LogicAnd is on while all of them are.
+	LogicAnd
+	// LogicToggle turns on or off each time any of them turns on.
+	LogicToggle
+	// LogicTimed turns on when any of them turns on, and off again Time
+	// seconds later.
+	LogicTimed
+)
+
+var wireLogicNames = map[WireLogic]string{
+	LogicOr:     "or",
+	LogicAnd:    "and",
+	LogicToggle: "toggle",
+	LogicTimed:  "timed",
+}
+
+type WireAction int
+
+const (
+	// ActionOpen opens a door while the wire is on, and closes it when
+	// the wire turns off. ActionClose does the opposite.
+	ActionOpen WireAction = iota
+	ActionClose
+	// ActionEnable makes a connection usable while the wire is on.
+	// ActionDisable does the opposite.
+	ActionEnable
+	ActionDisable
+	// ActionSet changes tiles to the target's On tile while the wire is on,
+	// and to its Off tile when the wire turns off.
+	ActionSet
+	// ActionSpawn brings an entity back, as it was when the room was first
+	// entered, each time the wire turns on.
+	ActionSpawn
+)
+
+var wireActionNames = map[WireAction]string{
+	ActionOpen:    "open",
+	ActionClose:   "close",
+	ActionEnable:  "enable",
+	ActionDisable: "disable",
+	ActionSet:     "set",
+	ActionSpawn:   "spawn",
+}
+
+type TargetKind int
+
+const (
+	TargetDoor TargetKind = iota
+	TargetConnection
+	TargetTiles
+	TargetEntity
+)
+
+// actionTargets says what kind of target each action works on.
+var actionTargets = map[WireAction]TargetKind{
+	ActionOpen:    TargetDoor,
+	ActionClose:   TargetDoor,
+	ActionEnable:  TargetConnection,
+	ActionDisable: TargetConnection,
+	ActionSet:     TargetTiles,
+	ActionSpawn:   TargetEntity,
+}
+
+// WireTarget is something in a room that wires act on, named so that wires
+// can refer to it.
+type WireTarget struct {
+	ID   string
+	Kind TargetKind
+
+	// At is the cell of a door or connection.
+	At Point3D
+
+	// From and To are opposite corners of the tiles a TargetTiles changes,
+	// between On and Off.
+	From, To [3]int
+	On, Off  TileType
+
+	// Entity is the ID of the entity a TargetEntity brings back.
+	Entity int
+}
+
+// Wire passes the state of Sources, the IDs of switches, through its Logic
+// and does its Action to the target named Target.
+type Wire struct {
+	Sources []int
+	Logic   WireLogic
+	Time    float32
+	Action  WireAction
+	Target  string
+
+	// Input is what the switches added up to last frame, so that toggle
+	// and timed wires can tell when it turns on. On is the wire's output,
+	// and Applied the output last acted on; they differ while the action
+	// cannot be done yet, such as a door that has something in the way.
+	Input   bool
+	On      bool
+	Applied bool
+	Timer   float32
+}
+
+func ParseWireLogic(name string) (WireLogic, bool) {
+	for l, n := range wireLogicNames {
+		if n == name {
+			return l, true
+		}
+	}
+	return LogicOr, false
+}
+
+func ParseWireAction(name string) (WireAction, bool) {
+	for a, n := range wireActionNames {
+		if n == name {
+			return a, true
+		}
+	}
+	return ActionOpen, false
+}
+
+func (fg *FilmationGame) updateWire(wire *Wire, deltaTime float32) {
+	anyOn, allOn := false, len(wire.Sources) > 0
+	for _, id := range wire.Sources {
+		on := fg.switchOn(id)
+		anyOn = anyOn || on
+		allOn = allOn && on
+	}
+	input := anyOn
+	if wire.Logic == LogicAnd {
+		input = allOn
+	}
+
+	switch wire.Logic {
+	case LogicOr, LogicAnd:
+		wire.On = input
+	case LogicToggle:
+		if input && !wire.Input {
+			wire.On = !wire.On
+		}
+	case LogicTimed:
+		if input && !wire.Input {
+			wire.Timer = wire.Time
+		} else if wire.Timer > 0 {
+			wire.Timer -= deltaTime
+		}
+		wire.On = wire.Timer > 0
+	}
+	wire.Input = input
+
+	if wire.On != wire.Applied && fg.applyWire(wire) {
+		wire.Applied = wire.On
+	}
+}
+
+// applyWire does a wire's action to its target, for the wire turning on or
+// off. It reports whether the action could be done.
+func (fg *FilmationGame) applyWire(wire *Wire) bool {
+	room := fg.Rooms.Rooms[fg.Rooms.CurrentRoom]
+	target := room.target(wire.Target)
+	if target == nil {
+		return true
+	}
+
+	on := wire.On
+	switch wire.Action {
+	case ActionOpen, ActionClose:
+		return fg.setDoor(target.At, on == (wire.Action == ActionOpen))
+
+	case ActionEnable, ActionDisable:
+		for i := range room.Connections {
+			if conn := &room.Connections[i]; conn.Position == target.At {
+				conn.Active = on == (wire.Action == ActionEnable)
+			}
+		}
+
+	case ActionSet:
+		tileType := target.Off
+		if on {
+			tileType = target.On
+		}
+		for x := target.From[0]; x <= target.To[0]; x++ {
+			for y := target.From[1]; y <= target.To[1]; y++ {
+				for z := target.From[2]; z <= target.To[2]; z++ {
+					fg.World.Tiles[x][y][z] = NewTile(tileType, x, y, z)
+				}
+			}
+		}
+
+	case ActionSpawn:
+		if on {
+			fg.respawn(room, target.Entity)
+		}
+	}
+	return true
+}
+
+func (room *Room) target(id string) *WireTarget {
+	for i := range room.Targets {
+		if room.Targets[i].ID == id {
+			return &room.Targets[i]
+		}
+	}
+	return nil
+}
+
+// respawn puts an entity back as it was when the room was first entered,
+// unless it is still about.
+func (fg *FilmationGame) respawn(room *Room, id int) {
+	for i := range fg.World.Entities {
+		entity := &fg.World.Entities[i]
+		if entity.ID != id || entity.Active {
+			continue
+		}
+
+		fresh := *entity
+		for _, spawned := range room.spawn {
+			if spawned.ID == id {
+				fresh = spawned
+			}
+		}
+		fresh.Active = true
+		fresh.Health = fresh.MaxHealth
+		fresh.TargetPosition = fresh.Position
+		fresh.IsMoving = false
+		fresh.VelocityY = 0
+		fg.UpdateEntityBounds(&fresh)
+		*entity = fresh
+		return
+	}
+}
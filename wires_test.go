@@ -0,0 +1,195 @@
+package main
+
+import "testing"
+
+// TestWireLogic feeds two switches through a wire of each logic, a step at
+// a time, and checks the wire's output after each step.
+func TestWireLogic(t *testing.T) {
+	type step struct {
+		a, b bool
+		dt   float32
+		want bool
+	}
+	tests := []struct {
+		name  string
+		logic WireLogic
+		time  float32
+		steps []step
+	}{
+		{"or", LogicOr, 0, []step{
+			{false, false, 0.1, false},
+			{true, false, 0.1, true},
+			{true, true, 0.1, true},
+			{false, true, 0.1, true},
+			{false, false, 0.1, false},
+		}},
+		{"and", LogicAnd, 0, []step{
+			{true, false, 0.1, false},
+			{true, true, 0.1, true},
+			{false, true, 0.1, false},
+		}},
+		{"toggle turns on and off on each press", LogicToggle, 0, []step{
+			{true, false, 0.1, true},
+			{true, false, 0.1, true},
+			{false, false, 0.1, true},
+			{false, true, 0.1, false},
+			{true, true, 0.1, false},
+			{false, false, 0.1, false},
+			{true, true, 0.1, true},
+		}},
+		{"timed expires while held", LogicTimed, 1, []step{
+			{true, false, 0.1, true},
+			{true, false, 0.5, true},
+			{true, false, 0.5, false},
+			{true, false, 0.5, false},
+		}},
+		{"timed starts again on a new press", LogicTimed, 1, []step{
+			{true, false, 0.1, true},
+			{false, false, 0.8, true},
+			{false, true, 0.1, true},
+			{false, true, 0.5, true},
+			{false, true, 0.5, false},
+		}},
+	}
+
+	for _, test := range tests {
+		fg := &FilmationGame{}
+		fg.InitRoomSystem()
+		fg.CreateRoom(1, "Hall", 4, 3, 4)
+		a := NewEntity(1, EntitySwitch, Point3D{X: 1, Y: 1, Z: 1}, switchLever)
+		b := NewEntity(2, EntitySwitch, Point3D{X: 2, Y: 1, Z: 1}, switchLever)
+		fg.World.Entities = []GameEntity{a, b}
+		wire := Wire{Sources: []int{1, 2}, Logic: test.logic, Time: test.time}
+
+		for i, s := range test.steps {
+			fg.World.Entities[0].On, fg.World.Entities[1].On = s.a, s.b
+			fg.updateWire(&wire, s.dt)
+			if wire.On != s.want {
+				t.Errorf("%s: step %d with switches %v %v: wire is %v, want %v", test.name, i+1, s.a, s.b, wire.On, s.want)
+				break
+			}
+		}
+	}
+}
+
+const wiredLevel = `{"version": 1,
+ "start": {"room": 1, "position": [1, 1, 1]},
+ "rooms": [
+  {"id": 1, "name": "Hall", "size": [8, 4, 8], "floor": "floor_stone",
+   "connections": [
+     {"at": [4, 1, 0], "to_room": 2, "to": [1, 1, 1], "direction": "up", "requires_key": true},
+     {"at": [7, 1, 4], "to_room": 2, "to": [1, 1, 2], "direction": "right"}
+   ],
+   "entities": [
+     {"id": 10, "type": "switch", "sprite": "lever", "at": [1, 1, 3]},
+     {"id": 11, "type": "switch", "sprite": "lever", "at": [1, 1, 5]},
+     {"id": 12, "type": "switch", "sprite": "plate", "at": [3, 1, 3]},
+     {"id": 13, "type": "switch", "sprite": "floor", "at": [5, 1, 5]},
+     {"id": 14, "type": "enemy", "sprite": "orc", "at": [6, 1, 6], "health": 0, "max_health": 3, "active": false}
+   ],
+   "targets": [
+     {"id": "gate", "door": [4, 1, 0]},
+     {"id": "exit", "connection": [7, 1, 4]},
+     {"id": "bridge", "tiles": {"from": [1, 0, 6], "to": [2, 0, 6], "on": "floor_wood"}},
+     {"id": "orc", "entity": 14}
+   ],
+   "wires": [
+     {"sources": [10], "action": "open", "target": "gate"},
+     {"sources": [11], "action": "disable", "target": "exit"},
+     {"sources": [12], "action": "set", "target": "bridge"},
+     {"sources": [13], "action": "spawn", "target": "orc"}
+   ]},
+  {"id": 2, "name": "Vault", "size": [4, 4, 4], "floor": "floor_stone",
+   "connections": [
+     {"at": [0, 1, 1], "to_room": 1, "to": [3, 1, 1], "direction": "left"}
+   ]}
+ ]}`
+
+// TestWireActions builds a room from level data and works each kind of
+// target through its wire, without drawing anything.
+func TestWireActions(t *testing.T) {
+	entity := func(fg *FilmationGame, id int) *GameEntity {
+		for i := range fg.World.Entities {
+			if fg.World.Entities[i].ID == id {
+				return &fg.World.Entities[i]
+			}
+		}
+		t.Fatalf("no entity %d", id)
+		return nil
+	}
+	block := func(fg *FilmationGame, id int, at Point3D) {
+		fg.World.Entities = append(fg.World.Entities, NewEntity(id, EntityBlock, at, 0))
+	}
+	unblock := func(fg *FilmationGame, id int) {
+		entity(fg, id).Active = false
+	}
+	gateOpen := func(fg *FilmationGame) bool { return !fg.World.Tiles[4][1][0].Solid }
+	exitActive := func(fg *FilmationGame) bool { return fg.Rooms.Rooms[1].Connections[1].Active }
+	bridged := func(fg *FilmationGame) bool {
+		return fg.World.Tiles[1][0][6].Type == TileWoodFloor && fg.World.Tiles[2][0][6].Type == TileWoodFloor
+	}
+
+	type step struct {
+		what  string
+		do    func(fg *FilmationGame)
+		check func(fg *FilmationGame) bool
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"a lever opens and closes a door", []step{
+			{"locked door starts closed", func(fg *FilmationGame) {}, func(fg *FilmationGame) bool { return !gateOpen(fg) }},
+			{"lever on opens it", func(fg *FilmationGame) { entity(fg, 10).On = true }, gateOpen},
+			{"lever off closes it", func(fg *FilmationGame) { entity(fg, 10).On = false }, func(fg *FilmationGame) bool { return !gateOpen(fg) }},
+		}},
+		{"a door waits for its doorway to clear", []step{
+			{"lever on opens it", func(fg *FilmationGame) { entity(fg, 10).On = true }, gateOpen},
+			{"a block in the doorway keeps it open", func(fg *FilmationGame) {
+				block(fg, 50, Point3D{X: 4, Y: 1, Z: 0})
+				entity(fg, 10).On = false
+			}, gateOpen},
+			{"it stays open while the block is there", func(fg *FilmationGame) {}, gateOpen},
+			{"it closes once the block is gone", func(fg *FilmationGame) { unblock(fg, 50) }, func(fg *FilmationGame) bool { return !gateOpen(fg) }},
+		}},
+		{"a lever disables and enables a connection", []step{
+			{"connection starts active", func(fg *FilmationGame) {}, exitActive},
+			{"lever on disables it", func(fg *FilmationGame) { entity(fg, 11).On = true }, func(fg *FilmationGame) bool { return !exitActive(fg) }},
+			{"lever off enables it", func(fg *FilmationGame) { entity(fg, 11).On = false }, exitActive},
+		}},
+		{"a plate sets tiles", []step{
+			{"tiles start as the floor", func(fg *FilmationGame) {}, func(fg *FilmationGame) bool { return fg.World.Tiles[1][0][6].Type == TileStoneFloor }},
+			{"a block on the plate sets them", func(fg *FilmationGame) { block(fg, 50, Point3D{X: 3, Y: 1, Z: 3}) }, bridged},
+			{"taking it off puts them back", func(fg *FilmationGame) { unblock(fg, 50) }, func(fg *FilmationGame) bool {
+				return fg.World.Tiles[1][0][6].Type == TileStoneFloor && fg.World.Tiles[2][0][6].Type == TileStoneFloor
+			}},
+		}},
+		{"a floor switch respawns an enemy", []step{
+			{"enemy starts gone", func(fg *FilmationGame) {}, func(fg *FilmationGame) bool { return !entity(fg, 14).Active }},
+			{"stepping on the switch brings it back", func(fg *FilmationGame) { block(fg, 50, Point3D{X: 5, Y: 1, Z: 5}) }, func(fg *FilmationGame) bool {
+				orc := entity(fg, 14)
+				return orc.Active && orc.Health == orc.MaxHealth && orc.Position == (Point3D{X: 6, Y: 1, Z: 6})
+			}},
+			{"the switch stays on once stepped off", func(fg *FilmationGame) { unblock(fg, 50) }, func(fg *FilmationGame) bool { return entity(fg, 13).On }},
+		}},
+	}
+
+	for _, test := range tests {
+		level, err := ParseLevel("wired.json", []byte(wiredLevel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fg := &FilmationGame{}
+		if err := fg.BuildLevel(level); err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range test.steps {
+			s.do(fg)
+			fg.UpdateSwitches(0.1)
+			if !s.check(fg) {
+				t.Errorf("%s: %s: it did not", test.name, s.what)
+				break
+			}
+		}
+	}
+}
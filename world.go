@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"slices"
 
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
@@ -165,54 +166,66 @@ func (fg *FilmationGame) BuildWorld() {
 		entityID++
 	}
 
-	player := GameEntity{
-		ID:        entityID,
-		Type:      EntityPlayer,
-		Position:  world.PlayerSpawn,
-		Direction: DirDown,
-		Bounds: BoundingBox3D{
-			Min: Point3D{X: world.PlayerSpawn.X - 0.4, Y: world.PlayerSpawn.Y - 0.4, Z: world.PlayerSpawn.Z - 0.4},
-			Max: Point3D{X: world.PlayerSpawn.X + 0.4, Y: world.PlayerSpawn.Y + 0.4, Z: world.PlayerSpawn.Z + 0.4},
-		},
-		Active:    true,
-		Color:     rl.White,
-		Health:    10,
-		MaxHealth: 10,
-	}
-
-	world.Entities = append(world.Entities, player)
-	fg.Player = &world.Entities[len(world.Entities)-1]
+	fg.Player = NewPlayer(world.PlayerSpawn)
 
 	fg.World = world
 
 	fmt.Printf("Built 3D world: %dx%dx%d with %d entities\n", world.Width, world.Height, world.Depth, len(world.Entities))
 }
 
-func (fg *FilmationGame) IsPositionSolid(pos Point3D) bool {
-	x, y, z := int(pos.X), int(pos.Y), int(pos.Z)
+func (w *World3D) inBounds(x, y, z int) bool {
+	return x >= 0 && x < w.Width && y >= 0 && y < w.Height && z >= 0 && z < w.Depth
+}
 
-	if x < 0 || x >= fg.World.Width || y < 0 || y >= fg.World.Height || z < 0 || z >= fg.World.Depth {
+// IsTileSolid reports whether the tile at a grid cell blocks movement.
+// Cells outside the world count as solid.
+func (w *World3D) IsTileSolid(x, y, z int) bool {
+	if x < 0 || x >= w.Width || y < 0 || y >= w.Height || z < 0 || z >= w.Depth {
 		return true
 	}
 
-	tile := &fg.World.Tiles[x][y][z]
-	if tile.Type != TileEmpty && tile.Solid {
+	tile := &w.Tiles[x][y][z]
+	return tile.Type != TileEmpty && tile.Solid
+}
+
+func (fg *FilmationGame) IsPositionSolid(pos Point3D) bool {
+	return fg.World.IsPositionSolid(pos)
+}
+
+// IsPositionSolid reports whether something standing at pos would be
+// blocked, either by a solid tile, a floor or ceiling, or by an enemy, a
+// block or a platform. An entity in the air is in the cell nearest its
+// height.
+func (w *World3D) IsPositionSolid(pos Point3D) bool {
+	return w.IsPositionSolidExcept(pos, nil)
+}
+
+// IsPositionSolidExcept is IsPositionSolid, ignoring the given entities, such
+// as the ones that are moving there together.
+func (w *World3D) IsPositionSolidExcept(pos Point3D, except []*GameEntity) bool {
+	cell := cellOf(pos)
+	if w.blocksAt(cell[0], cell[1], cell[2]) {
 		return true
 	}
+	return w.solidEntityAt(pos, except) != nil
+}
 
+// solidEntityAt returns the enemy, NPC, block or platform in the way of
+// something standing at pos, leaving out the given entities, or nil if there
+// is none.
+func (w *World3D) solidEntityAt(pos Point3D, except []*GameEntity) *GameEntity {
 	checkBounds := BoundingBox3D{
 		Min: Point3D{X: pos.X - 0.4, Y: pos.Y - 0.4, Z: pos.Z - 0.4},
 		Max: Point3D{X: pos.X + 0.4, Y: pos.Y + 0.4, Z: pos.Z + 0.4},
 	}
 
-	for i := range fg.World.Entities {
-		entity := &fg.World.Entities[i]
-		if entity.Active && entity.Type == EntityEnemy {
+	for i := range w.Entities {
+		entity := &w.Entities[i]
+		if isSolidEntity(entity) && !slices.Contains(except, entity) {
 			if BoundingBoxesIntersect(checkBounds, entity.Bounds) {
-				return true
+				return entity
 			}
 		}
 	}
-
-	return false
+	return nil
 }
\ No newline at end of file